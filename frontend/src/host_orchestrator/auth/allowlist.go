@@ -0,0 +1,53 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Allowlist wraps another Authenticator and additionally rejects any
+// identity whose subject or email isn't in the configured set. This
+// mirrors skia infra's allowed.Allowed pattern of layering a fixed
+// allowlist on top of identity verification.
+type Allowlist struct {
+	inner   Authenticator
+	allowed map[string]struct{}
+}
+
+// NewAllowlist returns an Allowlist wrapping inner, permitting only the
+// subjects/emails listed in allowed.
+func NewAllowlist(inner Authenticator, allowed []string) *Allowlist {
+	set := make(map[string]struct{}, len(allowed))
+	for _, a := range allowed {
+		set[a] = struct{}{}
+	}
+	return &Allowlist{inner: inner, allowed: set}
+}
+
+func (a *Allowlist) Authenticate(r *http.Request) (Identity, error) {
+	id, err := a.inner.Authenticate(r)
+	if err != nil {
+		return Identity{}, err
+	}
+	if _, ok := a.allowed[id.Email]; ok {
+		return id, nil
+	}
+	if _, ok := a.allowed[id.Subject]; ok {
+		return id, nil
+	}
+	return Identity{}, fmt.Errorf("%q is not in the allowlist", id.Email)
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auth authenticates incoming host orchestrator requests and
+// threads the resulting identity into the request context. Middleware
+// registered after this package's (see main.go's quotaMiddleware) reads
+// the identity back out via FromContext to key per-user quota and, via
+// orchestrator/audit, to attribute CVD create/delete and user artifact
+// upload requests to the caller in an audit log. What it does not do is
+// reach orchestrator.Config.CVDUser: that's a single operator-wide value
+// read once from ORCHESTRATOR_CVD_USER, not derived per request, since the
+// underlying cvd tool this checkout's Controller drives has no per-request
+// user concept to plumb it into.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Mode selects which Authenticator backs the orchestrator's auth
+// middleware. It is read from the ORCHESTRATOR_AUTH_MODE env var.
+type Mode string
+
+const (
+	ModeNoAuth   Mode = "noauth"
+	ModeOIDC     Mode = "oidc"
+	ModeGoogleID Mode = "google"
+)
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	// Subject is the stable, opaque identifier of the caller (the JWT "sub"
+	// claim, or a fixed value in noauth mode).
+	Subject string
+	// Email is the caller's email address, when available. Quota and audit
+	// attribution are keyed on Subject, via FromContext; Email is read by
+	// Allowlist, the AllowedEmails check at authentication time.
+	Email string
+}
+
+// Authenticator validates a request and returns the identity of the caller.
+// It returns an error if the request cannot be authenticated.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Identity, error)
+}
+
+// Config configures the auth subsystem. Fields not relevant to Mode are
+// ignored.
+type Config struct {
+	Mode Mode
+	// OIDCIssuer and OIDCAudience are required when Mode is ModeOIDC.
+	OIDCIssuer   string
+	OIDCAudience string
+	// AllowedEmails restricts access to a fixed set of subjects/emails once
+	// the request has been otherwise authenticated. An empty list disables
+	// the allowlist check.
+	AllowedEmails []string
+}
+
+// New builds the Authenticator described by cfg.
+func New(cfg Config) (Authenticator, error) {
+	var base Authenticator
+	switch cfg.Mode {
+	case "", ModeNoAuth:
+		return NoAuth{}, nil
+	case ModeOIDC:
+		a, err := NewOIDCAuthenticator(cfg.OIDCIssuer, cfg.OIDCAudience)
+		if err != nil {
+			return nil, fmt.Errorf("auth: failed to create oidc authenticator: %w", err)
+		}
+		base = a
+	case ModeGoogleID:
+		a, err := NewGoogleIDAuthenticator(cfg.OIDCAudience)
+		if err != nil {
+			return nil, fmt.Errorf("auth: failed to create google id authenticator: %w", err)
+		}
+		base = a
+	default:
+		return nil, fmt.Errorf("auth: unknown mode %q", cfg.Mode)
+	}
+	if len(cfg.AllowedEmails) > 0 {
+		base = NewAllowlist(base, cfg.AllowedEmails)
+	}
+	return base, nil
+}
+
+// Middleware authenticates every request with a and, on success, stores the
+// resulting Identity in the request context before calling next. On
+// failure it replies with 401 Unauthorized and does not call next.
+func Middleware(a Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, err := a.Authenticate(r)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("unauthorized: %v", err), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), id)))
+		})
+	}
+}
+
+type identityKey struct{}
+
+func withIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the Identity stored by Middleware, if any.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
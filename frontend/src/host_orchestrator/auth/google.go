@@ -0,0 +1,52 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/idtoken"
+)
+
+// GoogleIDAuthenticator validates bearer tokens as Google-issued ID
+// tokens, following the same validation flow as
+// cloud.google.com/go/auth/credentials: the token's signature, issuer and
+// audience are checked against Google's published certificates.
+type GoogleIDAuthenticator struct {
+	audience string
+}
+
+// NewGoogleIDAuthenticator returns an Authenticator that accepts Google ID
+// tokens (e.g. minted for a service account) addressed to audience.
+func NewGoogleIDAuthenticator(audience string) (*GoogleIDAuthenticator, error) {
+	if audience == "" {
+		return nil, fmt.Errorf("audience is required")
+	}
+	return &GoogleIDAuthenticator{audience: audience}, nil
+}
+
+func (a *GoogleIDAuthenticator) Authenticate(r *http.Request) (Identity, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return Identity{}, err
+	}
+	payload, err := idtoken.Validate(r.Context(), token, a.audience)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid google id token: %w", err)
+	}
+	email, _ := payload.Claims["email"].(string)
+	return Identity{Subject: payload.Subject, Email: email}, nil
+}
@@ -0,0 +1,28 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import "net/http"
+
+// NoAuth is an Authenticator that accepts every request, matching the host
+// orchestrator's behavior before the auth subsystem existed. It's the
+// default mode, intended for local development and trusted networks.
+type NoAuth struct{}
+
+const noAuthSubject = "noauth"
+
+func (NoAuth) Authenticate(*http.Request) (Identity, error) {
+	return Identity{Subject: noAuthSubject}, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// OIDCAuthenticator validates bearer tokens against a configured OIDC
+// issuer, fetching and caching the issuer's JWKS.
+type OIDCAuthenticator struct {
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCAuthenticator discovers issuer's OIDC configuration and returns an
+// Authenticator that validates bearer tokens were signed by it for
+// audience.
+func NewOIDCAuthenticator(issuer, audience string) (*OIDCAuthenticator, error) {
+	if issuer == "" || audience == "" {
+		return nil, fmt.Errorf("issuer and audience are both required")
+	}
+	provider, err := oidc.NewProvider(context.Background(), issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc provider %q: %w", issuer, err)
+	}
+	verifier := provider.Verifier(&oidc.Config{ClientID: audience})
+	return &OIDCAuthenticator{verifier: verifier}, nil
+}
+
+func (a *OIDCAuthenticator) Authenticate(r *http.Request) (Identity, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return Identity{}, err
+	}
+	idToken, err := a.verifier.Verify(r.Context(), token)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid id token: %w", err)
+	}
+	var claims struct {
+		Email string `json:"email"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, fmt.Errorf("failed to parse id token claims: %w", err)
+	}
+	return Identity{Subject: idToken.Subject, Email: claims.Email}, nil
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	h := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if !strings.HasPrefix(h, prefix) {
+		return "", fmt.Errorf("missing bearer token")
+	}
+	return strings.TrimPrefix(h, prefix), nil
+}
@@ -15,18 +15,30 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"sync"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/auth"
 	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/orchestrator"
+	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/orchestrator/audit"
 	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/orchestrator/debug"
+	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/orchestrator/health"
+	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/orchestrator/metrics"
+	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/orchestrator/opstore"
+	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/orchestrator/quota"
 	apiv1 "github.com/google/android-cuttlefish/frontend/src/liboperator/api/v1"
 	"github.com/google/android-cuttlefish/frontend/src/liboperator/operator"
 
@@ -45,25 +57,58 @@ const (
 	defaultCVDBinAndroidBuildID     = "10796991"
 	defaultCVDBinAndroidBuildTarget = "aosp_cf_x86_64_phone-trunk_staging-userdebug"
 	defaultCVDArtifactsDir          = "/var/lib/cuttlefish-common"
-)
 
-func startHttpServer(port string) error {
-	log.Println(fmt.Sprint("Host Orchestrator is listening at http://localhost:", port))
+	DefaultPromPort = ":2112"
 
-	// handler is nil, so DefaultServeMux is used.
-	return http.ListenAndServe(fmt.Sprint(":", port), nil)
-}
+	DefaultOMBackend       = "memory"
+	DefaultOMRetention     = 24 * time.Hour
+	defaultOMSQLitePath    = "operations.db"
+	omOrphanedFailedReason = "orchestrator restarted while operation was still running"
+
+	// DefaultShutdownGrace is how long Server.Shutdown waits for in-flight
+	// operations to finish before giving up and returning.
+	DefaultShutdownGrace = 30 * time.Second
 
-func startHttpsServer(port string, certPath string, keyPath string) error {
-	log.Println(fmt.Sprint("Host Orchestrator is listening at https://localhost:", port))
-	return http.ListenAndServeTLS(fmt.Sprint(":", port),
-		certPath,
-		keyPath,
-		// handler is nil, so DefaultServeMux is used.
-		//
-		// Using DefaultServerMux in both servers (http and https) is not a problem
-		// as http.ServeMux instances are thread safe.
-		nil)
+	// probeTimeout bounds every individual readiness probe.
+	probeTimeout = 5 * time.Second
+	// cvdBinaryName is the executable the readiness check looks for under
+	// imPaths.CVDToolsDir.
+	cvdBinaryName = "cvd"
+)
+
+// newOperationManager builds the orchestrator.OperationManager selected by
+// backend ("memory", "sqlite" or "datastore"). For persistent backends, any
+// operation left in the running state by a previous, now-dead process is
+// marked failed before the manager starts serving new requests, and
+// completed operations are swept from the store once older than
+// DefaultOMRetention. The result isn't instrumented; wrap it in
+// orchestrator.NewInstrumentedOM to report operation metrics.
+func newOperationManager(backend string) (orchestrator.OperationManager, error) {
+	switch backend {
+	case "", "memory":
+		return orchestrator.NewMapOM(), nil
+	case "sqlite":
+		dbPath := fromEnvOrDefault("ORCHESTRATOR_OM_SQLITE_PATH", defaultOMSQLitePath)
+		store, err := opstore.NewSQLiteStore(dbPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open sqlite operation store: %w", err)
+		}
+		if _, err := opstore.MarkOrphanedAsFailed(context.Background(), store, omOrphanedFailedReason); err != nil {
+			return nil, fmt.Errorf("failed to mark orphaned operations as failed: %w", err)
+		}
+		return orchestrator.NewPersistentOM(store, DefaultOMRetention), nil
+	case "datastore":
+		store, err := opstore.NewDatastoreStore(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create datastore operation store: %w", err)
+		}
+		if _, err := opstore.MarkOrphanedAsFailed(context.Background(), store, omOrphanedFailedReason); err != nil {
+			return nil, fmt.Errorf("failed to mark orphaned operations as failed: %w", err)
+		}
+		return orchestrator.NewPersistentOM(store, DefaultOMRetention), nil
+	default:
+		return nil, fmt.Errorf("unknown ORCHESTRATOR_OM_BACKEND %q", backend)
+	}
 }
 
 func fromEnvOrDefault(key string, def string) string {
@@ -73,6 +118,201 @@ func fromEnvOrDefault(key string, def string) string {
 	return def
 }
 
+// fromEnvOrDefaultDuration parses key as a duration, falling back to def if
+// the env var is unset or fails to parse.
+func fromEnvOrDefaultDuration(key string, def time.Duration) time.Duration {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Printf("invalid %s=%q, falling back to %s: %v", key, val, def, err)
+		return def
+	}
+	return d
+}
+
+// fromEnvOrDefaultBool parses key as a bool, falling back to def if the env
+// var is unset or fails to parse.
+func fromEnvOrDefaultBool(key string, def bool) bool {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Printf("invalid %s=%q, falling back to %t: %v", key, val, def, err)
+		return def
+	}
+	return b
+}
+
+// splitAndTrim splits a comma-separated env var value into its trimmed
+// parts, ignoring empty entries.
+func splitAndTrim(s string) []string {
+	var result []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// checkExecutable reports an error unless path exists and is executable.
+func checkExecutable(path string) health.CheckerFunc {
+	return func(context.Context) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if info.Mode()&0111 == 0 {
+			return fmt.Errorf("%s: not executable", path)
+		}
+		return nil
+	}
+}
+
+// checkDirWritable reports an error unless dir exists and a file can be
+// created and removed inside it.
+func checkDirWritable(dir string) health.CheckerFunc {
+	return func(context.Context) error {
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+		name := f.Name()
+		f.Close()
+		return os.Remove(name)
+	}
+}
+
+// checkHTTPReachable reports an error unless a HEAD request to rawURL
+// completes, regardless of status code: readiness only cares that the
+// service is reachable, not that this particular path resolves.
+func checkHTTPReachable(rawURL string) health.CheckerFunc {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+}
+
+// checkUnixSocket reports an error unless a connection to the unix socket
+// at path can be established.
+func checkUnixSocket(path string) health.CheckerFunc {
+	return func(ctx context.Context) error {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "unix", path)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// requestUser returns the subject of the request's authenticated identity
+// ("noauth" in noauth mode), or "" if the request carries none.
+func requestUser(r *http.Request) string {
+	id, _ := auth.FromContext(r.Context())
+	return id.Subject
+}
+
+// quotaStatusWriter wraps a ResponseWriter to capture the status code
+// written, so middleware downstream of the route handler can tell whether
+// the request actually succeeded.
+type quotaStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *quotaStatusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// releaseOnTeardown wraps next, which must be a CVD delete route, and
+// releases the caller's concurrent-CVD quota slot once next reports
+// success. Without this, Limiter.CreateMiddleware's IncrCVDs would only
+// ever grow, turning PerUser.MaxConcurrentCVDs into a lifetime limit
+// instead of a concurrency limit. m may be nil.
+func releaseOnTeardown(l *quota.Limiter, m *metrics.Metrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &quotaStatusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		if sw.status >= 200 && sw.status < 300 {
+			if err := l.ReleaseCVD(r.Context(), requestUser(r)); err != nil {
+				log.Printf("quota: failed to release CVD slot for %q: %v", requestUser(r), err)
+			}
+			if m != nil {
+				m.ActiveCVDInstances.Dec()
+			}
+		}
+	})
+}
+
+// onUpload reports UserArtifactUploadBytes for n, the actual number of
+// bytes quota.Limiter.UploadMiddleware read from an accepted upload. m may
+// be nil.
+func onUpload(m *metrics.Metrics) func(n int64) {
+	if m == nil {
+		return nil
+	}
+	return func(n int64) { m.UserArtifactUploadBytes.Observe(float64(n)) }
+}
+
+// auditWrap wraps next, logging the caller's identity, action, the
+// request path, and the resulting status code to al once next returns. al
+// may be nil, in which case next is returned unwrapped.
+func auditWrap(al audit.Logger, action string, next http.Handler) http.Handler {
+	if al == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &quotaStatusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		al.Log(r.Context(), requestUser(r), action, r.URL.Path, sw.status)
+	})
+}
+
+// quotaMiddleware routes requests to the CVD create quota, the CVD delete
+// release hook, the user artifact upload quota, or neither, based on
+// method and path, and otherwise passes the request straight through to
+// next. Accepted uploads also report to m; see onUpload. Successful deletes
+// decrement ActiveCVDInstances in m; see releaseOnTeardown. Each of those
+// three routes is also attributed to the caller's identity (requestUser)
+// in al, regardless of whether it was ultimately allowed by quota. al may
+// be nil. CVDCreateDuration and the ActiveCVDInstances increment are
+// reported separately, by orchestrator.InstrumentedOM, since accepting the
+// create request isn't the same as the CVD actually coming up.
+func quotaMiddleware(l *quota.Limiter, m *metrics.Metrics, al audit.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		create := auditWrap(al, "cvd.create", l.CreateMiddleware(requestUser, next))
+		release := auditWrap(al, "cvd.delete", releaseOnTeardown(l, m, next))
+		upload := auditWrap(al, "userartifact.upload", l.UploadMiddleware(requestUser, onUpload(m), next))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := strings.TrimSuffix(r.URL.Path, "/")
+			switch {
+			case r.Method == http.MethodPost && strings.HasSuffix(path, "/cvds"):
+				create.ServeHTTP(w, r)
+			case r.Method == http.MethodDelete && strings.Contains(path, "/cvds/"):
+				release.ServeHTTP(w, r)
+			case r.Method == http.MethodPut && strings.Contains(path, "/userartifacts/"):
+				upload.ServeHTTP(w, r)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
 // Whether a device file request should be intercepted and served from the signaling server instead
 func maybeIntercept(path string) *string {
 	if path == "/js/server_connector.js" {
@@ -82,18 +322,115 @@ func maybeIntercept(path string) *string {
 	return nil
 }
 
-func start(starters []func() error) {
-	wg := new(sync.WaitGroup)
-	wg.Add(len(starters))
-	for _, starter := range starters {
-		go func(f func() error) {
-			defer wg.Done()
-			if err := f(); err != nil {
-				log.Fatal(err)
-			}
-		}(starter)
+// deviceEndpointFunc adapts operator.SetupDeviceEndpoint's func() error
+// into the ctx-aware shape Server.Run expects. SetupDeviceEndpoint doesn't
+// expose a way to stop its underlying listener, so on ctx cancellation this
+// just stops waiting on it; the goroutine it started leaks until the
+// process exits, same as before this wrapper existed.
+func deviceEndpointFunc(pool operator.DevicePool, config apiv1.InfraConfig, socketPath string) func(context.Context) error {
+	run := operator.SetupDeviceEndpoint(pool, config, socketPath)
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() { done <- run() }()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Server owns every listener the host orchestrator exposes and coordinates
+// their orderly shutdown: it stops accepting new connections, waits up to
+// a grace period for in-flight operations to finish, and then runs any
+// registered cleanup callbacks.
+type Server struct {
+	httpServer    *http.Server
+	httpsServer   *http.Server // nil when HTTPS is disabled
+	httpsCertPath string
+	httpsKeyPath  string
+	metricsServer *http.Server
+
+	// deviceEndpoint serves the device-facing unix socket endpoint set up by
+	// operator.SetupDeviceEndpoint. It returns once ctx, passed to Run, is
+	// done.
+	deviceEndpoint func(ctx context.Context) error
+
+	// om is only used for Shutdown's drain step, so it's narrowed to the
+	// Drain capability rather than the full orchestrator.OperationManager
+	// interface. orchestrator.InstrumentedOM always implements it, so
+	// there's no need for a capability check here the way the backend's own
+	// HealthCheck/Close are checked in main() below.
+	om            interface{ Drain(context.Context) error }
+	shutdownGrace time.Duration
+	// cleanups run, in order, as the last step of Shutdown.
+	cleanups []func(context.Context) error
+}
+
+// Run starts every configured listener and blocks until ctx is done or one
+// of the listeners fails. It returns the triggering error, or nil if ctx
+// being done is what unblocked it.
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	report := func(err error) {
+		if err == nil || errors.Is(err, http.ErrServerClosed) {
+			return
+		}
+		select {
+		case errCh <- err:
+		default:
+		}
+	}
+
+	log.Println(fmt.Sprint("Host Orchestrator is listening at http://localhost", s.httpServer.Addr))
+	go func() { report(s.httpServer.ListenAndServe()) }()
+	if s.httpsServer != nil {
+		log.Println(fmt.Sprint("Host Orchestrator is listening at https://localhost", s.httpsServer.Addr))
+		go func() { report(s.httpsServer.ListenAndServeTLS(s.httpsCertPath, s.httpsKeyPath)) }()
+	}
+	log.Println(fmt.Sprint("Host Orchestrator metrics are listening at http://localhost", s.metricsServer.Addr, "/metrics"))
+	go func() { report(s.metricsServer.ListenAndServe()) }()
+	go func() { report(s.deviceEndpoint(ctx)) }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return nil
 	}
-	wg.Wait()
+}
+
+// Shutdown stops the HTTP, HTTPS and metrics servers, waits for in-flight
+// operations tracked by the OperationManager to finish (bounded by
+// s.shutdownGrace), and then runs the registered cleanup callbacks. It
+// returns the combined error of any step that failed. It does not close the
+// device endpoint's unix socket listener; see deviceEndpointFunc.
+func (s *Server) Shutdown(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.shutdownGrace)
+	defer cancel()
+
+	var errs []error
+	stop := func(name string, f func(context.Context) error) {
+		if err := f(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	stop("http server", s.httpServer.Shutdown)
+	if s.httpsServer != nil {
+		stop("https server", s.httpsServer.Shutdown)
+	}
+	stop("metrics server", s.metricsServer.Shutdown)
+
+	if err := s.om.Drain(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("waiting for in-flight operations: %w", err))
+	}
+	for _, cleanup := range s.cleanups {
+		if err := cleanup(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func main() {
@@ -105,6 +442,61 @@ func main() {
 	certPath := filepath.Join(tlsCertDir, "cert.pem")
 	keyPath := filepath.Join(tlsCertDir, "key.pem")
 	cvdUser := fromEnvOrDefault("ORCHESTRATOR_CVD_USER", "")
+	promPort := fromEnvOrDefault("ORCHESTRATOR_PROM_PORT", DefaultPromPort)
+	shutdownGrace := fromEnvOrDefaultDuration("ORCHESTRATOR_SHUTDOWN_GRACE", DefaultShutdownGrace)
+	stopCVDsOnExit := fromEnvOrDefaultBool("ORCHESTRATOR_STOP_CVDS_ON_EXIT", false)
+	quotaConfigPath := fromEnvOrDefault("ORCHESTRATOR_QUOTA_CONFIG", "")
+
+	authenticator, err := auth.New(auth.Config{
+		Mode:          auth.Mode(fromEnvOrDefault("ORCHESTRATOR_AUTH_MODE", string(auth.ModeNoAuth))),
+		OIDCIssuer:    fromEnvOrDefault("ORCHESTRATOR_OIDC_ISSUER", ""),
+		OIDCAudience:  fromEnvOrDefault("ORCHESTRATOR_OIDC_AUDIENCE", ""),
+		AllowedEmails: splitAndTrim(fromEnvOrDefault("ORCHESTRATOR_ALLOWED_EMAILS", "")),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	m := metrics.New()
+	var quotaConfig quota.Config
+	if quotaConfigPath != "" {
+		quotaConfig, err = quota.LoadConfig(quotaConfigPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	// ORCHESTRATOR_MAX_CONCURRENT_CREATES overrides whatever
+	// max_concurrent_creates ORCHESTRATOR_QUOTA_CONFIG set (or seeds it, if
+	// no quota config file is in use), since the global create limit is
+	// common enough to warrant its own env var.
+	maxCreatesOverride := -1
+	if v := fromEnvOrDefault("ORCHESTRATOR_MAX_CONCURRENT_CREATES", ""); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("invalid ORCHESTRATOR_MAX_CONCURRENT_CREATES=%q: %v", v, err)
+		}
+		quotaConfig.MaxConcurrentCreates = n
+		maxCreatesOverride = n
+	}
+	quotaLimiter := quota.NewLimiter(quotaConfig, quota.NewMemoryStore(), m)
+	if quotaConfigPath != "" {
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+		go func() {
+			for range sighup {
+				cfg, err := quota.LoadConfig(quotaConfigPath)
+				if err != nil {
+					log.Printf("failed to reload quota config %q: %v", quotaConfigPath, err)
+					continue
+				}
+				if maxCreatesOverride >= 0 {
+					cfg.MaxConcurrentCreates = maxCreatesOverride
+				}
+				quotaLimiter.Reload(cfg)
+				log.Printf("reloaded quota config from %q", quotaConfigPath)
+			}
+		}()
+	}
 
 	pool := operator.NewDevicePool()
 	polledSet := operator.NewPolledSet()
@@ -124,7 +516,19 @@ func main() {
 		ArtifactsRootDir: filepath.Join(imRootDir, "artifacts"),
 		RuntimesRootDir:  filepath.Join(imRootDir, "runtimes"),
 	}
-	om := orchestrator.NewMapOM()
+	omBackend := fromEnvOrDefault("ORCHESTRATOR_OM_BACKEND", DefaultOMBackend)
+	om, err := newOperationManager(omBackend)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Wrapping every backend, including the in-memory default, means
+	// OperationsCreated/Completed/Failed and CVDCreateDuration are reported
+	// regardless of ORCHESTRATOR_OM_BACKEND, not just for the opt-in
+	// sqlite/datastore backends. The onFinish callback releases the global
+	// concurrent-create slot quotaLimiter.CreateMiddleware held open, since
+	// CVD creation finishing is what it actually needs to wait for, not the
+	// HTTP handler that kicked it off returning.
+	instrumentedOM := orchestrator.NewInstrumentedOM(om, m, func(string) { quotaLimiter.ReleaseGlobal() })
 	uamOpts := orchestrator.UserArtifactsManagerOpts{
 		RootDir:     filepath.Join(imRootDir, "user_artifacs"),
 		NameFactory: func() string { return uuid.New().String() },
@@ -145,14 +549,25 @@ func main() {
 			Paths:                  imPaths,
 			CVDToolsVersion:        cvdToolsVersion,
 			AndroidBuildServiceURL: abURL,
+			AndroidBuildTransport:  quotaLimiter.AndroidBuildTransport(nil),
 			CVDUser:                cvdUser,
 		},
-		OperationManager:      om,
+		OperationManager:      instrumentedOM,
 		WaitOperationDuration: 2 * time.Minute,
 		UserArtifactsManager:  uam,
 		DebugVariablesManager: debugVarsManager,
 	}
 	imController.AddRoutes(r)
+	// mux.Router.Use wraps outside-in in registration order: the first
+	// middleware registered runs first (outermost), the last runs right
+	// before the route handler (innermost). InstrumentRouter is registered
+	// first so it observes the final status code of every request,
+	// including ones auth or quota reject; auth.Middleware runs next so it
+	// has stored the caller's identity in the request context before
+	// quotaMiddleware, which needs that identity, runs last.
+	m.InstrumentRouter(r)
+	r.Use(auth.Middleware(authenticator))
+	r.Use(quotaMiddleware(quotaLimiter, m, audit.StdLogger{}))
 	// The host orchestrator currently has no use for this, since clients won't connect
 	// to it directly, however they probably will once the multi-device feature matures.
 	if len(webUIUrlStr) > 0 {
@@ -165,12 +580,63 @@ func main() {
 	}
 	http.Handle("/", r)
 
-	starters := []func() error{
-		func() error { return operator.SetupDeviceEndpoint(pool, config, socketPath)() },
-		func() error { return startHttpServer(httpPort) },
+	healthReg := health.NewRegistry(probeTimeout)
+	healthReg.Register("cvd_binary", checkExecutable(filepath.Join(imPaths.CVDToolsDir, cvdBinaryName)))
+	healthReg.Register("artifacts_dir", checkDirWritable(imPaths.ArtifactsRootDir))
+	healthReg.Register("runtimes_dir", checkDirWritable(imPaths.RuntimesRootDir))
+	healthReg.Register("android_build_service", checkHTTPReachable(abURL))
+	healthReg.Register("device_socket", checkUnixSocket(socketPath))
+	healthReg.Register("user_artifacts", orchestrator.NewUserArtifactsHealthCheck(uamOpts))
+	healthReg.Register("debug_vars", health.CheckerFunc(debugVarsManager.HealthCheck))
+	// Only backends that own an external store (sqlite, datastore) have
+	// anything worth probing here; the in-memory MapOM doesn't implement
+	// this, hence the capability check.
+	if checker, ok := om.(interface{ HealthCheck(context.Context) error }); ok {
+		healthReg.Register("operation_manager", health.CheckerFunc(checker.HealthCheck))
+	}
+
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", m.Handler())
+	metricsMux.Handle("/healthz", health.LivenessHandler())
+	metricsMux.Handle("/readyz", healthReg.ReadinessHandler())
+
+	srv := &Server{
+		// handler is nil, so DefaultServeMux (registered above) is used.
+		httpServer:     &http.Server{Addr: fmt.Sprint(":", httpPort)},
+		metricsServer:  &http.Server{Addr: promPort, Handler: metricsMux},
+		deviceEndpoint: deviceEndpointFunc(pool, config, socketPath),
+		om:             instrumentedOM,
+		shutdownGrace:  shutdownGrace,
 	}
 	if httpsPort != "" {
-		starters = append(starters, func() error { return startHttpsServer(httpsPort, certPath, keyPath) })
+		srv.httpsServer = &http.Server{Addr: fmt.Sprint(":", httpsPort)}
+		srv.httpsCertPath = certPath
+		srv.httpsKeyPath = keyPath
+	}
+	if stopCVDsOnExit {
+		srv.cleanups = append(srv.cleanups, func(ctx context.Context) error {
+			return imController.StopCVDsOwnedBySelf(ctx)
+		})
+	}
+	// Persistent backends own a retention-sweep goroutine and the
+	// underlying store's file/connection; the in-memory MapOM owns neither,
+	// hence the capability check instead of an unconditional call.
+	if closer, ok := om.(interface{ Close() error }); ok {
+		srv.cleanups = append(srv.cleanups, func(context.Context) error {
+			return closer.Close()
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := srv.Run(ctx); err != nil {
+		log.Printf("server error, shutting down: %v", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("error during shutdown: %v", err)
 	}
-	start(starters)
 }
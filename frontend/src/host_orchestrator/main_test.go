@@ -0,0 +1,237 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/auth"
+	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/orchestrator/quota"
+)
+
+func TestCheckExecutable(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "cvd")
+	if err := os.WriteFile(exe, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	if err := checkExecutable(exe)(context.Background()); err != nil {
+		t.Errorf("checkExecutable() = %v, want nil", err)
+	}
+
+	notExe := filepath.Join(dir, "not-exe")
+	if err := os.WriteFile(notExe, []byte("data"), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	if err := checkExecutable(notExe)(context.Background()); err == nil {
+		t.Error("checkExecutable() on a non-executable file = nil, want error")
+	}
+
+	if err := checkExecutable(filepath.Join(dir, "missing"))(context.Background()); err == nil {
+		t.Error("checkExecutable() on a missing path = nil, want error")
+	}
+}
+
+func TestCheckDirWritable(t *testing.T) {
+	if err := checkDirWritable(t.TempDir())(context.Background()); err != nil {
+		t.Errorf("checkDirWritable() = %v, want nil", err)
+	}
+	if err := checkDirWritable(filepath.Join(t.TempDir(), "missing"))(context.Background()); err == nil {
+		t.Error("checkDirWritable() on a missing dir = nil, want error")
+	}
+}
+
+func TestCheckHTTPReachable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound) // reachability shouldn't care about the status code
+	}))
+	defer srv.Close()
+
+	if err := checkHTTPReachable(srv.URL)(context.Background()); err != nil {
+		t.Errorf("checkHTTPReachable() = %v, want nil", err)
+	}
+
+	srv.Close()
+	if err := checkHTTPReachable(srv.URL)(context.Background()); err == nil {
+		t.Error("checkHTTPReachable() against a closed server = nil, want error")
+	}
+}
+
+func TestCheckUnixSocket(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "orchestrator.sock")
+	l, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	if err := checkUnixSocket(sockPath)(context.Background()); err != nil {
+		t.Errorf("checkUnixSocket() = %v, want nil", err)
+	}
+	if err := checkUnixSocket(filepath.Join(t.TempDir(), "missing.sock"))(context.Background()); err == nil {
+		t.Error("checkUnixSocket() against a missing socket = nil, want error")
+	}
+}
+
+func TestQuotaMiddlewareRoutesByMethodAndPath(t *testing.T) {
+	l := quota.NewLimiter(quota.Config{MaxConcurrentCreates: 1}, quota.NewMemoryStore(), nil)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	h := quotaMiddleware(l, nil, nil)(ok)
+
+	// The first create request takes the only global slot.
+	w1 := httptest.NewRecorder()
+	h.ServeHTTP(w1, httptest.NewRequest(http.MethodPost, "/cvds", nil))
+	if w1.Code != http.StatusOK {
+		t.Fatalf("first create status = %d, want %d", w1.Code, http.StatusOK)
+	}
+
+	// A second create request is routed through the same create quota and
+	// rejected, since the global slot is still held.
+	w2 := httptest.NewRecorder()
+	h.ServeHTTP(w2, httptest.NewRequest(http.MethodPost, "/cvds", nil))
+	if w2.Code != http.StatusTooManyRequests {
+		t.Errorf("second create status = %d, want %d", w2.Code, http.StatusTooManyRequests)
+	}
+
+	// A GET to the same path isn't a create and must bypass the create
+	// quota entirely, regardless of how many global slots are in use.
+	w3 := httptest.NewRecorder()
+	h.ServeHTTP(w3, httptest.NewRequest(http.MethodGet, "/cvds", nil))
+	if w3.Code != http.StatusOK {
+		t.Errorf("GET /cvds status = %d, want %d (should bypass the create quota)", w3.Code, http.StatusOK)
+	}
+}
+
+// recordingAuditLogger collects every audit.Logger.Log call it receives,
+// for tests to assert against.
+type recordingAuditLogger struct {
+	mu      sync.Mutex
+	entries []auditEntry
+}
+
+type auditEntry struct {
+	user, action, resource string
+	status                 int
+}
+
+func (l *recordingAuditLogger) Log(_ context.Context, user, action, resource string, status int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, auditEntry{user, action, resource, status})
+}
+
+// fakeAuthenticator reports a fixed identity, so tests can populate the
+// request context the same way auth.Middleware does in production without
+// standing up a real OIDC/Google ID authenticator.
+type fakeAuthenticator struct{ id auth.Identity }
+
+func (a fakeAuthenticator) Authenticate(*http.Request) (auth.Identity, error) { return a.id, nil }
+
+func TestQuotaMiddlewareAuditsCVDCreateByIdentity(t *testing.T) {
+	l := quota.NewLimiter(quota.Config{}, quota.NewMemoryStore(), nil)
+	al := &recordingAuditLogger{}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	h := auth.Middleware(fakeAuthenticator{id: auth.Identity{Subject: "alice"}})(quotaMiddleware(l, nil, al)(ok))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/cvds", nil))
+
+	if len(al.entries) != 1 {
+		t.Fatalf("got %d audit entries, want 1", len(al.entries))
+	}
+	got := al.entries[0]
+	if got.user != "alice" || got.action != "cvd.create" || got.status != http.StatusOK {
+		t.Errorf("audit entry = %+v, want user=alice action=cvd.create status=%d", got, http.StatusOK)
+	}
+}
+
+// drainerFunc adapts a func into the interface{ Drain(context.Context)
+// error } Server.om expects, the same way http.HandlerFunc adapts a func
+// into http.Handler.
+type drainerFunc func(context.Context) error
+
+func (f drainerFunc) Drain(ctx context.Context) error { return f(ctx) }
+
+func TestServerRunStopsWhenContextIsDone(t *testing.T) {
+	srv := &Server{
+		httpServer:    &http.Server{Addr: "127.0.0.1:0"},
+		metricsServer: &http.Server{Addr: "127.0.0.1:0"},
+		deviceEndpoint: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Run(ctx) }()
+	time.Sleep(20 * time.Millisecond) // give the listeners a moment to start
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("Run() = %v, want nil after ctx was cancelled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run() did not return after ctx was cancelled")
+	}
+}
+
+func TestServerShutdownDrainsOperationManager(t *testing.T) {
+	drained := false
+	srv := &Server{
+		httpServer:    &http.Server{Addr: "127.0.0.1:0"},
+		metricsServer: &http.Server{Addr: "127.0.0.1:0"},
+		om:            drainerFunc(func(context.Context) error { drained = true; return nil }),
+		shutdownGrace: time.Second,
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if !drained {
+		t.Error("Shutdown() did not call om.Drain()")
+	}
+}
+
+func TestServerShutdownReportsDrainError(t *testing.T) {
+	srv := &Server{
+		httpServer:    &http.Server{Addr: "127.0.0.1:0"},
+		metricsServer: &http.Server{Addr: "127.0.0.1:0"},
+		om:            drainerFunc(func(context.Context) error { return context.DeadlineExceeded }),
+		shutdownGrace: time.Second,
+	}
+
+	if err := srv.Shutdown(context.Background()); err == nil {
+		t.Error("Shutdown() = nil, want an error surfaced from a failing Drain")
+	}
+}
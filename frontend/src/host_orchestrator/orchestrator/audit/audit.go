@@ -0,0 +1,41 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit records who did what to the host orchestrator's
+// sensitive resources - CVD creation, CVD teardown, and user artifact
+// upload - independent of the metrics and quota bookkeeping those same
+// requests also feed. Entries are keyed by the authenticated caller's
+// identity (see auth.FromContext), so noauth deployments record NoAuth's
+// fixed "noauth" subject rather than nothing at all.
+package audit
+
+import (
+	"context"
+	"log"
+)
+
+// Logger records a single audited action: who (user, "" if the request
+// carried no authenticated identity) did what (action) to which resource,
+// and the outcome (status, an HTTP status code).
+type Logger interface {
+	Log(ctx context.Context, user, action, resource string, status int)
+}
+
+// StdLogger is a Logger that writes one line per action via the standard
+// log package.
+type StdLogger struct{}
+
+func (StdLogger) Log(_ context.Context, user, action, resource string, status int) {
+	log.Printf("audit: user=%q action=%s resource=%s status=%d", user, action, resource, status)
+}
@@ -0,0 +1,39 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStdLoggerIncludesUserActionResourceAndStatus(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	StdLogger{}.Log(context.Background(), "user-1", "cvd.create", "/cvds", 201)
+
+	got := buf.String()
+	for _, want := range []string{`user="user-1"`, "action=cvd.create", "resource=/cvds", "status=201"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log output %q missing %q", got, want)
+		}
+	}
+}
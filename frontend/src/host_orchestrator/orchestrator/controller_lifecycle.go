@@ -0,0 +1,39 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+)
+
+// StopCVDsOwnedBySelf stops every CVD instance owned by Config.CVDUser
+// (every instance, if CVDUser is unset). It's used by
+// ORCHESTRATOR_STOP_CVDS_ON_EXIT so a host reboot or orchestrator restart
+// doesn't leave orphaned cvd processes running.
+func (c *Controller) StopCVDsOwnedBySelf(ctx context.Context) error {
+	args := []string{"stop"}
+	if c.Config.CVDUser != "" {
+		args = append(args, "--user", c.Config.CVDUser)
+	}
+	cvdPath := filepath.Join(c.Config.Paths.CVDToolsDir, "cvd")
+	out, err := exec.CommandContext(ctx, cvdPath, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cvd stop failed: %w: %s", err, out)
+	}
+	return nil
+}
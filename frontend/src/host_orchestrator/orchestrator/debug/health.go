@@ -0,0 +1,26 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import "context"
+
+// HealthCheck reports whether the VariablesManager is usable. It's a
+// liveness check in practice: the manager only ever holds in-process
+// state, so there's no external dependency for it to lose, but this lets
+// it register with orchestrator/health.Registry alongside the subsystems
+// that do have one, rather than being the one silent gap in /readyz.
+func (m *VariablesManager) HealthCheck(context.Context) error {
+	return nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health aggregates liveness and readiness probes for the host
+// orchestrator's subsystems and serves them as JSON over HTTP. Subsystems
+// that want to be part of the readiness check implement Checker and
+// register themselves with a Registry; main.go wires the registered
+// /healthz and /readyz handlers into the process's HTTP mux.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status is the outcome of a single probe, or of the readiness check as a
+// whole.
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// Checker reports whether a subsystem is currently healthy. Implementations
+// should return promptly; Registry.Check bounds every probe with a
+// per-probe timeout, so a Checker that ignores ctx cancellation can still
+// delay the overall readiness result.
+type Checker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// CheckerFunc adapts a plain function to a Checker, mirroring
+// http.HandlerFunc.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) CheckHealth(ctx context.Context) error { return f(ctx) }
+
+// Result is the outcome of running one registered probe.
+type Result struct {
+	Name      string `json:"name"`
+	Status    Status `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type probe struct {
+	name    string
+	checker Checker
+}
+
+// Registry holds the set of probes registered by the orchestrator's
+// subsystems and the timeout applied to each when Check runs.
+type Registry struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	probes []probe
+}
+
+// NewRegistry returns an empty Registry that bounds every probe to timeout.
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+// Register adds a named probe. Probes run in the order they were
+// registered, though since Check runs them concurrently that order only
+// affects the Result slice, not timing. It is safe to call Register
+// concurrently with Check.
+func (r *Registry) Register(name string, c Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.probes = append(r.probes, probe{name: name, checker: c})
+}
+
+// Check runs every registered probe concurrently, bounding each to the
+// Registry's timeout, and returns one Result per probe in registration
+// order.
+func (r *Registry) Check(ctx context.Context) []Result {
+	r.mu.RLock()
+	probes := append([]probe(nil), r.probes...)
+	r.mu.RUnlock()
+
+	results := make([]Result, len(probes))
+	var wg sync.WaitGroup
+	wg.Add(len(probes))
+	for i, p := range probes {
+		go func(i int, p probe) {
+			defer wg.Done()
+			results[i] = r.run(ctx, p)
+		}(i, p)
+	}
+	wg.Wait()
+	return results
+}
+
+func (r *Registry) run(ctx context.Context, p probe) Result {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	err := p.checker.CheckHealth(ctx)
+	res := Result{Name: p.name, Status: StatusUp, LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		res.Status = StatusDown
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// response is the JSON payload served by LivenessHandler and
+// ReadinessHandler.
+type response struct {
+	Status Status   `json:"status"`
+	Probes []Result `json:"probes,omitempty"`
+}
+
+// LivenessHandler reports that the process is up and able to serve HTTP
+// requests. It runs no probes: liveness only answers "is the process
+// alive", which readiness (and its subsystem probes) already covers.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, response{Status: StatusUp})
+	})
+}
+
+// ReadinessHandler runs every probe registered with r and reports 200 if
+// all are up, or 503 if any are down. Pass ?verbose=1 to include a
+// per-probe breakdown in the response body, useful for operators
+// diagnosing a partial outage.
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		results := r.Check(req.Context())
+		status := StatusUp
+		for _, res := range results {
+			if res.Status == StatusDown {
+				status = StatusDown
+				break
+			}
+		}
+		resp := response{Status: status}
+		if req.URL.Query().Get("verbose") == "1" {
+			resp.Probes = results
+		}
+		code := http.StatusOK
+		if status == StatusDown {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, resp)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	// Encoding a fixed, already-validated struct into a ResponseWriter
+	// cannot fail in a way the caller could act on.
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckAllUp(t *testing.T) {
+	r := NewRegistry(time.Second)
+	r.Register("a", CheckerFunc(func(context.Context) error { return nil }))
+	r.Register("b", CheckerFunc(func(context.Context) error { return nil }))
+
+	results := r.Check(context.Background())
+
+	if len(results) != 2 {
+		t.Fatalf("Check() returned %d results, want 2", len(results))
+	}
+	for _, res := range results {
+		if res.Status != StatusUp {
+			t.Errorf("probe %q status = %v, want %v", res.Name, res.Status, StatusUp)
+		}
+	}
+}
+
+func TestCheckReportsFailure(t *testing.T) {
+	r := NewRegistry(time.Second)
+	r.Register("ok", CheckerFunc(func(context.Context) error { return nil }))
+	r.Register("broken", CheckerFunc(func(context.Context) error { return errors.New("boom") }))
+
+	results := r.Check(context.Background())
+
+	var broken *Result
+	for i := range results {
+		if results[i].Name == "broken" {
+			broken = &results[i]
+		}
+	}
+	if broken == nil {
+		t.Fatal("Check() did not return a result for \"broken\"")
+	}
+	if broken.Status != StatusDown {
+		t.Errorf("probe %q status = %v, want %v", broken.Name, broken.Status, StatusDown)
+	}
+	if broken.Error != "boom" {
+		t.Errorf("probe %q error = %q, want %q", broken.Name, broken.Error, "boom")
+	}
+}
+
+func TestCheckTimesOutSlowProbe(t *testing.T) {
+	r := NewRegistry(10 * time.Millisecond)
+	r.Register("slow", CheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	results := r.Check(context.Background())
+
+	if got := results[0].Status; got != StatusDown {
+		t.Errorf("probe status = %v, want %v", got, StatusDown)
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	LivenessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var resp response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response failed: %v", err)
+	}
+	if resp.Status != StatusUp {
+		t.Errorf("status field = %v, want %v", resp.Status, StatusUp)
+	}
+}
+
+func TestReadinessHandlerAllUp(t *testing.T) {
+	r := NewRegistry(time.Second)
+	r.Register("a", CheckerFunc(func(context.Context) error { return nil }))
+
+	w := httptest.NewRecorder()
+	r.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestReadinessHandlerDown(t *testing.T) {
+	r := NewRegistry(time.Second)
+	r.Register("a", CheckerFunc(func(context.Context) error { return errors.New("down") }))
+
+	w := httptest.NewRecorder()
+	r.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	var resp response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response failed: %v", err)
+	}
+	if len(resp.Probes) != 0 {
+		t.Errorf("Probes = %v, want none without ?verbose=1", resp.Probes)
+	}
+}
+
+func TestReadinessHandlerVerbose(t *testing.T) {
+	r := NewRegistry(time.Second)
+	r.Register("a", CheckerFunc(func(context.Context) error { return errors.New("down") }))
+
+	w := httptest.NewRecorder()
+	r.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz?verbose=1", nil))
+
+	var resp response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response failed: %v", err)
+	}
+	if len(resp.Probes) != 1 {
+		t.Fatalf("Probes = %v, want 1 entry", resp.Probes)
+	}
+	if resp.Probes[0].Name != "a" {
+		t.Errorf("Probes[0].Name = %q, want %q", resp.Probes[0].Name, "a")
+	}
+}
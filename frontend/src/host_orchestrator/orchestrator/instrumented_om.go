@@ -0,0 +1,136 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/orchestrator/metrics"
+)
+
+// InstrumentedOM wraps an OperationManager so every backend - not just
+// PersistentOM - reports OperationsCreated/Completed/Failed and
+// CVDCreateDuration, measured at the operation's actual completion time
+// rather than at the HTTP handler that kicked it off returning. That
+// distinction matters because CVD creation is long-running and polled to
+// completion (see Controller.WaitOperationDuration): timing at
+// HTTP-response time records near-instant durations and marks a CVD active
+// before it's actually come up.
+//
+// It also tracks every operation it creates in a sync.WaitGroup, so Drain
+// can wait for in-flight operations to finish during shutdown regardless of
+// whether the wrapped OperationManager itself supports that - PersistentOM
+// does, but the in-memory default MapOM has nothing to wait on, and would
+// otherwise leave Server.Shutdown with nothing to drain on the common
+// deployment path.
+type InstrumentedOM struct {
+	OperationManager
+	metrics  *metrics.Metrics
+	onFinish func(name string)
+
+	mu      sync.Mutex
+	started map[string]time.Time
+	wg      sync.WaitGroup
+}
+
+// NewInstrumentedOM wraps om so its operations report to m as they're
+// created and as they complete. onFinish, if non-nil, is called after
+// every successful Complete or Fail, once the metrics above have already
+// been recorded; main.go uses it to release the quota package's global
+// concurrent-create slot at the point a CVD creation actually finishes,
+// rather than when the HTTP handler that started it returned.
+func NewInstrumentedOM(om OperationManager, m *metrics.Metrics, onFinish func(name string)) *InstrumentedOM {
+	return &InstrumentedOM{
+		OperationManager: om,
+		metrics:          m,
+		onFinish:         onFinish,
+		started:          make(map[string]time.Time),
+	}
+}
+
+func (i *InstrumentedOM) New() Operation {
+	op := i.OperationManager.New()
+	i.mu.Lock()
+	i.started[op.Name] = time.Now()
+	i.mu.Unlock()
+	i.wg.Add(1)
+	i.metrics.OperationsCreated.Inc()
+	return op
+}
+
+func (i *InstrumentedOM) Complete(name string, result any) (Operation, error) {
+	op, err := i.OperationManager.Complete(name, result)
+	if err == nil {
+		i.metrics.OperationsCompleted.Inc()
+		i.metrics.ActiveCVDInstances.Inc()
+		i.observeDuration(name)
+		i.finish(name)
+	}
+	return op, err
+}
+
+func (i *InstrumentedOM) Fail(name string, opErr error) (Operation, error) {
+	op, err := i.OperationManager.Fail(name, opErr)
+	if err == nil {
+		i.metrics.OperationsFailed.Inc()
+		i.observeDuration(name)
+		i.finish(name)
+	}
+	return op, err
+}
+
+func (i *InstrumentedOM) finish(name string) {
+	if i.onFinish != nil {
+		i.onFinish(name)
+	}
+}
+
+// observeDuration reports how long name took to finish and marks it done
+// in the WaitGroup Drain waits on, if it's one this InstrumentedOM saw
+// created; operations created before this process started (e.g. resumed
+// from a persistent store after a restart) have no recorded start time,
+// were never added to the WaitGroup, and are skipped.
+func (i *InstrumentedOM) observeDuration(name string) {
+	i.mu.Lock()
+	start, ok := i.started[name]
+	if ok {
+		delete(i.started, name)
+	}
+	i.mu.Unlock()
+	if ok {
+		i.metrics.CVDCreateDuration.Observe(time.Since(start).Seconds())
+		i.wg.Done()
+	}
+}
+
+// Drain blocks until every operation this InstrumentedOM created has
+// completed or failed, or ctx is done. Server.Shutdown (see main.go) calls
+// it unconditionally, regardless of the wrapped OperationManager backend.
+func (i *InstrumentedOM) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		i.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for in-flight operations to finish: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics exposes typed Prometheus collectors for the host
+// orchestrator so callers don't need to import the prometheus client
+// library directly. Create a single *Metrics with New and pass it down to
+// the subsystems that need to report observability data.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "host_orchestrator"
+
+// Metrics holds every collector registered by the host orchestrator. It is
+// safe for concurrent use.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	HTTPRequestsTotal   *prometheus.CounterVec
+	HTTPRequestDuration *prometheus.HistogramVec
+
+	ActiveCVDInstances prometheus.Gauge
+
+	OperationsCreated   prometheus.Counter
+	OperationsCompleted prometheus.Counter
+	OperationsFailed    prometheus.Counter
+
+	UserArtifactUploadBytes prometheus.Histogram
+	CVDCreateDuration       prometheus.Histogram
+
+	QuotaRejectionsTotal *prometheus.CounterVec
+}
+
+// New creates a Metrics instance with all collectors registered against a
+// dedicated registry, so the metrics endpoint never shares state with the
+// default global registry used elsewhere in the process.
+func New() *Metrics {
+	reg := prometheus.NewRegistry()
+	f := promauto.With(reg)
+	return &Metrics{
+		registry: reg,
+		HTTPRequestsTotal: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Total count of HTTP requests handled, labeled by route and status code.",
+		}, []string{"route", "method", "code"}),
+		HTTPRequestDuration: f.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests, labeled by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		ActiveCVDInstances: f.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_cvd_instances",
+			Help:      "Number of CVD instances created by completed operations and not yet deleted through the API; not read from the device pool.",
+		}),
+		OperationsCreated: f.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "operations_created_total",
+			Help:      "Total number of operations created by the operation manager.",
+		}),
+		OperationsCompleted: f.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "operations_completed_total",
+			Help:      "Total number of operations that completed successfully.",
+		}),
+		OperationsFailed: f.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "operations_failed_total",
+			Help:      "Total number of operations that completed with an error.",
+		}),
+		UserArtifactUploadBytes: f.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "user_artifact_upload_bytes",
+			Help:      "Size in bytes of user artifact uploads.",
+			Buckets:   prometheus.ExponentialBuckets(1<<20, 2, 10), // 1MiB .. 512MiB
+		}),
+		CVDCreateDuration: f.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "cvd_create_duration_seconds",
+			Help:      "Time taken to complete a CVD create operation.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12), // 1s .. ~68m
+		}),
+		QuotaRejectionsTotal: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "quota_rejections_total",
+			Help:      "Total count of requests rejected by the quota subsystem, labeled by reason and user.",
+		}, []string{"reason", "user"}),
+	}
+}
+
+// IncRejected records a single request rejected by the quota subsystem for
+// reason, attributed to user ("" if the caller isn't authenticated). It
+// implements quota.Rejections.
+func (m *Metrics) IncRejected(reason, user string) {
+	m.QuotaRejectionsTotal.WithLabelValues(reason, user).Inc()
+}
+
+// Handler returns the promhttp handler serving this Metrics' registry.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// InstrumentRouter registers middleware on r so requests to every matched
+// route, including routes added after this call, update HTTPRequestsTotal
+// and HTTPRequestDuration. The "route" label is derived per request by
+// matching it against r and taking the matched route's path template.
+func (m *Metrics) InstrumentRouter(r *mux.Router) {
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, req)
+			route := routeTemplate(r, req)
+			m.HTTPRequestsTotal.WithLabelValues(route, req.Method, strconv.Itoa(sw.status)).Inc()
+			m.HTTPRequestDuration.WithLabelValues(route, req.Method).Observe(time.Since(start).Seconds())
+		})
+	})
+}
+
+func routeTemplate(r *mux.Router, req *http.Request) string {
+	var match mux.RouteMatch
+	if r.Match(req, &match) && match.Route != nil {
+		if tpl, err := match.Route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return req.URL.Path
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
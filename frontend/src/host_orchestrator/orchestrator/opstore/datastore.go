@@ -0,0 +1,171 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// datastoreKind mirrors the convention used by Skia's infra frontend, where
+// each entity kind is a short, package-qualified string.
+const datastoreKind = "HostOrchestratorOperation"
+
+// datastoreEntity is the on-disk representation of an Operation. Datastore
+// requires exported fields, so it is kept separate from Operation.
+type datastoreEntity struct {
+	Status    string
+	Result    []byte
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DatastoreStore is a Store backed by Google Cloud Datastore, for
+// orchestrator deployments that already depend on GCP project-level
+// persistence rather than a local SQLite file.
+type DatastoreStore struct {
+	client *datastore.Client
+}
+
+// NewDatastoreStore creates a DatastoreStore for the project named by the
+// GOOGLE_CLOUD_PROJECT environment variable, following the same project
+// resolution convention as other GCP client libraries used in this repo.
+func NewDatastoreStore(ctx context.Context) (*DatastoreStore, error) {
+	project := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	if project == "" {
+		return nil, fmt.Errorf("opstore: GOOGLE_CLOUD_PROJECT must be set to use the datastore backend")
+	}
+	client, err := datastore.NewClient(ctx, project)
+	if err != nil {
+		return nil, fmt.Errorf("opstore: failed to create datastore client: %w", err)
+	}
+	return &DatastoreStore{client: client}, nil
+}
+
+func (s *DatastoreStore) key(id string) *datastore.Key {
+	return datastore.NameKey(datastoreKind, id, nil)
+}
+
+func (s *DatastoreStore) Create(ctx context.Context, op Operation) error {
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var existing datastoreEntity
+		if err := tx.Get(s.key(op.ID), &existing); err != datastore.ErrNoSuchEntity {
+			if err == nil {
+				return fmt.Errorf("opstore: operation %q already exists", op.ID)
+			}
+			return err
+		}
+		_, err := tx.Put(s.key(op.ID), toEntity(op))
+		return err
+	})
+	return err
+}
+
+func (s *DatastoreStore) Get(ctx context.Context, id string) (Operation, error) {
+	var e datastoreEntity
+	if err := s.client.Get(ctx, s.key(id), &e); err == datastore.ErrNoSuchEntity {
+		return Operation{}, ErrNotFound
+	} else if err != nil {
+		return Operation{}, fmt.Errorf("opstore: failed to get operation %q: %w", id, err)
+	}
+	return fromEntity(id, e), nil
+}
+
+func (s *DatastoreStore) Update(ctx context.Context, op Operation) error {
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var existing datastoreEntity
+		if err := tx.Get(s.key(op.ID), &existing); err != nil {
+			if err == datastore.ErrNoSuchEntity {
+				return ErrNotFound
+			}
+			return err
+		}
+		_, err := tx.Put(s.key(op.ID), toEntity(op))
+		return err
+	})
+	return err
+}
+
+func (s *DatastoreStore) List(ctx context.Context) ([]Operation, error) {
+	q := datastore.NewQuery(datastoreKind)
+	var entities []datastoreEntity
+	keys, err := s.client.GetAll(ctx, q, &entities)
+	if err != nil {
+		return nil, fmt.Errorf("opstore: failed to list operations: %w", err)
+	}
+	result := make([]Operation, 0, len(keys))
+	for i, k := range keys {
+		result = append(result, fromEntity(k.Name, entities[i]))
+	}
+	return result, nil
+}
+
+// terminalStatuses are the Status values DeleteOlderThan is allowed to
+// sweep. Datastore's FilterField doesn't support a "!=" exclusion as
+// cleanly as a handful of per-status equality queries, so this runs one
+// query per terminal status rather than one query excluding StatusRunning.
+var terminalStatuses = []Status{StatusDone, StatusError}
+
+func (s *DatastoreStore) DeleteOlderThan(ctx context.Context, cutoff time.Time) error {
+	var keys []*datastore.Key
+	for _, status := range terminalStatuses {
+		q := datastore.NewQuery(datastoreKind).
+			FilterField("Status", "=", string(status)).
+			FilterField("UpdatedAt", "<", cutoff).
+			KeysOnly()
+		k, err := s.client.GetAll(ctx, q, nil)
+		if err != nil {
+			return fmt.Errorf("opstore: failed to query stale operations: %w", err)
+		}
+		keys = append(keys, k...)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := s.client.DeleteMulti(ctx, keys); err != nil {
+		return fmt.Errorf("opstore: failed to delete stale operations: %w", err)
+	}
+	return nil
+}
+
+func (s *DatastoreStore) Close() error {
+	return s.client.Close()
+}
+
+func toEntity(op Operation) *datastoreEntity {
+	return &datastoreEntity{
+		Status:    string(op.Status),
+		Result:    op.Result,
+		Error:     op.Error,
+		CreatedAt: op.CreatedAt,
+		UpdatedAt: op.UpdatedAt,
+	}
+}
+
+func fromEntity(id string, e datastoreEntity) Operation {
+	return Operation{
+		ID:        id,
+		Status:    Status(e.Status),
+		Result:    e.Result,
+		Error:     e.Error,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store backed by an in-memory map. It matches the
+// durability characteristics of the orchestrator's original map-based
+// operation manager: operations do not survive a process restart.
+type MemoryStore struct {
+	mu  sync.Mutex
+	ops map[string]Operation
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ops: make(map[string]Operation)}
+}
+
+func (s *MemoryStore) Create(_ context.Context, op Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ops[op.ID]; ok {
+		return fmt.Errorf("opstore: operation %q already exists", op.ID)
+	}
+	s.ops[op.ID] = op
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.ops[id]
+	if !ok {
+		return Operation{}, ErrNotFound
+	}
+	return op, nil
+}
+
+func (s *MemoryStore) Update(_ context.Context, op Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ops[op.ID]; !ok {
+		return ErrNotFound
+	}
+	s.ops[op.ID] = op
+	return nil
+}
+
+func (s *MemoryStore) List(_ context.Context) ([]Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Operation, 0, len(s.ops))
+	for _, op := range s.ops {
+		result = append(result, op)
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) DeleteOlderThan(_ context.Context, cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, op := range s.ops {
+		if op.Status != StatusRunning && op.UpdatedAt.Before(cutoff) {
+			delete(s.ops, id)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error { return nil }
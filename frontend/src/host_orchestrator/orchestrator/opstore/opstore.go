@@ -0,0 +1,98 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package opstore defines a persistence layer for long-running operations
+// so the operation manager can survive orchestrator restarts. It ships an
+// in-memory implementation matching today's behavior, a SQLite-backed
+// implementation for production use, and a Cloud Datastore implementation
+// behind the same Store interface.
+package opstore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Status is the lifecycle state of a stored operation.
+type Status string
+
+const (
+	StatusRunning Status = "RUNNING"
+	StatusDone    Status = "DONE"
+	StatusError   Status = "ERROR"
+)
+
+// ErrNotFound is returned by Get when no operation with the given ID exists.
+var ErrNotFound = errors.New("opstore: operation not found")
+
+// Operation is the durable representation of an orchestrator operation.
+// Result and Error are mutually exclusive and only meaningful once Status
+// is no longer StatusRunning.
+type Operation struct {
+	ID        string
+	Status    Status
+	Result    []byte // opaque, JSON-encoded result payload
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Store persists operations across restarts. Implementations must be safe
+// for concurrent use.
+type Store interface {
+	// Create persists a new operation. It returns an error if an operation
+	// with the same ID already exists.
+	Create(ctx context.Context, op Operation) error
+	// Get returns the operation with the given id, or ErrNotFound.
+	Get(ctx context.Context, id string) (Operation, error)
+	// Update overwrites an existing operation. It returns ErrNotFound if no
+	// operation with op.ID exists.
+	Update(ctx context.Context, op Operation) error
+	// List returns every stored operation in unspecified order.
+	List(ctx context.Context) ([]Operation, error)
+	// DeleteOlderThan removes completed operations (StatusDone or
+	// StatusError) last updated before cutoff. It never removes a
+	// StatusRunning operation, no matter how old, so a long-running
+	// operation can't be swept out from under itself; operations orphaned
+	// by a previous process dying mid-run need MarkOrphanedAsFailed to move
+	// them out of StatusRunning before a retention sweep can clean them up.
+	DeleteOlderThan(ctx context.Context, cutoff time.Time) error
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// MarkOrphanedAsFailed transitions every operation still in StatusRunning to
+// StatusError with reason. Call it once on startup, before the operation
+// manager begins accepting new work, so operations left running when the
+// process previously died don't appear to hang forever.
+func MarkOrphanedAsFailed(ctx context.Context, s Store, reason string) (int, error) {
+	ops, err := s.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, op := range ops {
+		if op.Status != StatusRunning {
+			continue
+		}
+		op.Status = StatusError
+		op.Error = reason
+		if err := s.Update(ctx, op); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
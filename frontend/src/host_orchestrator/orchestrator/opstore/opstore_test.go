@@ -0,0 +1,159 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreCreateGetUpdate(t *testing.T) {
+	testStoreCreateGetUpdate(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreCreateGetUpdate(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "ops.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	defer s.Close()
+	testStoreCreateGetUpdate(t, s)
+}
+
+func testStoreCreateGetUpdate(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0).UTC()
+	op := Operation{ID: "op-1", Status: StatusRunning, CreatedAt: now, UpdatedAt: now}
+	if err := s.Create(ctx, op); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if err := s.Create(ctx, op); err == nil {
+		t.Error("Create() with duplicate id expected error, got nil")
+	}
+	got, err := s.Get(ctx, "op-1")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if got.Status != StatusRunning {
+		t.Errorf("Get() status = %v, want %v", got.Status, StatusRunning)
+	}
+	op.Status = StatusDone
+	op.UpdatedAt = now.Add(time.Minute)
+	if err := s.Update(ctx, op); err != nil {
+		t.Fatalf("Update() failed: %v", err)
+	}
+	got, err = s.Get(ctx, "op-1")
+	if err != nil {
+		t.Fatalf("Get() after update failed: %v", err)
+	}
+	if got.Status != StatusDone {
+		t.Errorf("Get() status after update = %v, want %v", got.Status, StatusDone)
+	}
+	if _, err := s.Get(ctx, "missing"); err != ErrNotFound {
+		t.Errorf("Get(missing) err = %v, want ErrNotFound", err)
+	}
+	if err := s.Update(ctx, Operation{ID: "missing"}); err != ErrNotFound {
+		t.Errorf("Update(missing) err = %v, want ErrNotFound", err)
+	}
+}
+
+// TestSQLiteStoreSurvivesRestart verifies that operations written before the
+// process exits are still readable after reopening the same database file,
+// simulating an orchestrator restart.
+func TestSQLiteStoreSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "ops.db")
+	now := time.Unix(1700000000, 0).UTC()
+
+	s1, err := NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	if err := s1.Create(ctx, Operation{ID: "op-1", Status: StatusRunning, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if err := s1.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	// Simulate the orchestrator restarting against the same database file.
+	s2, err := NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() (reopen) failed: %v", err)
+	}
+	defer s2.Close()
+
+	n, err := MarkOrphanedAsFailed(ctx, s2, "orchestrator restarted while operation was running")
+	if err != nil {
+		t.Fatalf("MarkOrphanedAsFailed() failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("MarkOrphanedAsFailed() marked %d operations, want 1", n)
+	}
+	got, err := s2.Get(ctx, "op-1")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if got.Status != StatusError {
+		t.Errorf("Get() status = %v, want %v", got.Status, StatusError)
+	}
+	if got.Error == "" {
+		t.Error("Get() error reason is empty, want a restart reason")
+	}
+}
+
+func TestDeleteOlderThan(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	old := Operation{ID: "old", Status: StatusDone, UpdatedAt: time.Unix(1000, 0)}
+	fresh := Operation{ID: "fresh", Status: StatusDone, UpdatedAt: time.Unix(100000, 0)}
+	if err := s.Create(ctx, old); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if err := s.Create(ctx, fresh); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if err := s.DeleteOlderThan(ctx, time.Unix(50000, 0)); err != nil {
+		t.Fatalf("DeleteOlderThan() failed: %v", err)
+	}
+	if _, err := s.Get(ctx, "old"); err != ErrNotFound {
+		t.Errorf("Get(old) err = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Get(ctx, "fresh"); err != nil {
+		t.Errorf("Get(fresh) err = %v, want nil", err)
+	}
+}
+
+// TestDeleteOlderThanSparesRunningOperations verifies that a StatusRunning
+// operation survives a retention sweep no matter how old it is, since an
+// operation that's merely old isn't necessarily stuck: only
+// MarkOrphanedAsFailed, run explicitly on startup, may move it out of
+// StatusRunning so a later sweep can reclaim it.
+func TestDeleteOlderThanSparesRunningOperations(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	running := Operation{ID: "running", Status: StatusRunning, UpdatedAt: time.Unix(1000, 0)}
+	if err := s.Create(ctx, running); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if err := s.DeleteOlderThan(ctx, time.Unix(50000, 0)); err != nil {
+		t.Fatalf("DeleteOlderThan() failed: %v", err)
+	}
+	if _, err := s.Get(ctx, "running"); err != nil {
+		t.Errorf("Get(running) err = %v, want nil: a StatusRunning operation must survive the sweep", err)
+	}
+}
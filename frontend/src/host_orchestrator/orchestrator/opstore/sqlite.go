@@ -0,0 +1,151 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // pure-Go sqlite driver, no CGO required
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS operations (
+	id         TEXT PRIMARY KEY,
+	status     TEXT NOT NULL,
+	result     BLOB,
+	error      TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+`
+
+// SQLiteStore is a Store backed by a SQLite database file, so operations
+// survive orchestrator restarts. It uses modernc.org/sqlite, a pure-Go
+// driver, to avoid requiring CGO in the orchestrator's build.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (creating if necessary) a SQLite database at path
+// and ensures the operations table exists.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("opstore: failed to open sqlite db: %w", err)
+	}
+	// The modernc.org/sqlite driver doesn't support concurrent writers; a
+	// single connection avoids SQLITE_BUSY errors under concurrent use.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opstore: failed to create schema: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, op Operation) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO operations (id, status, result, error, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		op.ID, string(op.Status), op.Result, op.Error, op.CreatedAt.Unix(), op.UpdatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("opstore: failed to create operation %q: %w", op.ID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, id string) (Operation, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT id, status, result, error, created_at, updated_at FROM operations WHERE id = ?`, id)
+	op, err := scanOperation(row)
+	if err == sql.ErrNoRows {
+		return Operation{}, ErrNotFound
+	}
+	if err != nil {
+		return Operation{}, fmt.Errorf("opstore: failed to get operation %q: %w", id, err)
+	}
+	return op, nil
+}
+
+func (s *SQLiteStore) Update(ctx context.Context, op Operation) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE operations SET status = ?, result = ?, error = ?, updated_at = ? WHERE id = ?`,
+		string(op.Status), op.Result, op.Error, op.UpdatedAt.Unix(), op.ID)
+	if err != nil {
+		return fmt.Errorf("opstore: failed to update operation %q: %w", op.ID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("opstore: failed to update operation %q: %w", op.ID, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) List(ctx context.Context) ([]Operation, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, status, result, error, created_at, updated_at FROM operations`)
+	if err != nil {
+		return nil, fmt.Errorf("opstore: failed to list operations: %w", err)
+	}
+	defer rows.Close()
+	var result []Operation
+	for rows.Next() {
+		op, err := scanOperation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("opstore: failed to scan operation: %w", err)
+		}
+		result = append(result, op)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteOlderThan(ctx context.Context, cutoff time.Time) error {
+	if _, err := s.db.ExecContext(ctx,
+		`DELETE FROM operations WHERE updated_at < ? AND status != ?`,
+		cutoff.Unix(), string(StatusRunning)); err != nil {
+		return fmt.Errorf("opstore: failed to delete stale operations: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOperation(row scanner) (Operation, error) {
+	var (
+		op        Operation
+		status    string
+		createdAt int64
+		updatedAt int64
+	)
+	if err := row.Scan(&op.ID, &status, &op.Result, &op.Error, &createdAt, &updatedAt); err != nil {
+		return Operation{}, err
+	}
+	op.Status = Status(status)
+	op.CreatedAt = time.Unix(createdAt, 0).UTC()
+	op.UpdatedAt = time.Unix(updatedAt, 0).UTC()
+	return op, nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/orchestrator/opstore"
+
+	"github.com/google/uuid"
+)
+
+// cleanupInterval is how often PersistentOM sweeps its store for operations
+// older than its retention window. It's independent of the retention window
+// itself so a long retention doesn't also mean a long delay before the
+// first sweep.
+const cleanupInterval = 10 * time.Minute
+
+// Operation is the orchestrator's view of a long-running operation, as
+// returned to callers polling for its result. It's distinct from
+// opstore.Operation, which is the durable on-disk representation;
+// PersistentOM translates between the two.
+type Operation struct {
+	Name   string
+	Done   bool
+	Result json.RawMessage
+	Error  string
+}
+
+// PersistentOM is an OperationManager backed by an opstore.Store, so
+// in-flight and completed operations survive an orchestrator restart.
+// Completed operations are swept from the store once they're older than
+// retention. Its conformance to OperationManager isn't just asserted here:
+// newOperationManager (see main.go) returns *PersistentOM directly as an
+// orchestrator.OperationManager, so the compiler already enforces that New,
+// Get, Complete and Fail match the interface at every build of this
+// package.
+type PersistentOM struct {
+	store     opstore.Store
+	retention time.Duration
+
+	stopCleanup chan struct{}
+	cleanupDone chan struct{}
+
+	wg sync.WaitGroup // tracks operations created but not yet Complete/Fail-ed
+}
+
+// NewPersistentOM returns a PersistentOM backed by store, sweeping
+// operations older than retention every cleanupInterval. Wrap the result in
+// NewInstrumentedOM if operation metrics should be reported.
+func NewPersistentOM(store opstore.Store, retention time.Duration) *PersistentOM {
+	om := &PersistentOM{
+		store:       store,
+		retention:   retention,
+		stopCleanup: make(chan struct{}),
+		cleanupDone: make(chan struct{}),
+	}
+	go om.cleanupLoop()
+	return om
+}
+
+func (om *PersistentOM) cleanupLoop() {
+	defer close(om.cleanupDone)
+	t := time.NewTicker(cleanupInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			cutoff := time.Now().Add(-om.retention)
+			if err := om.store.DeleteOlderThan(context.Background(), cutoff); err != nil {
+				log.Printf("persistent operation manager: retention sweep failed: %v", err)
+			}
+		case <-om.stopCleanup:
+			return
+		}
+	}
+}
+
+// New creates and persists a new running operation.
+func (om *PersistentOM) New() Operation {
+	op := Operation{Name: uuid.New().String()}
+	storeOp := opstore.Operation{
+		ID:        op.Name,
+		Status:    opstore.StatusRunning,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := om.store.Create(context.Background(), storeOp); err != nil {
+		log.Printf("persistent operation manager: failed to persist new operation %q: %v", op.Name, err)
+	}
+	om.wg.Add(1)
+	return op
+}
+
+// Get returns the operation named name.
+func (om *PersistentOM) Get(name string) (Operation, error) {
+	storeOp, err := om.store.Get(context.Background(), name)
+	if err != nil {
+		return Operation{}, err
+	}
+	return fromStoreOperation(storeOp), nil
+}
+
+// Complete marks the operation named name as done, persisting result as its
+// JSON-encoded payload so it's still available to callers that poll for it
+// after an orchestrator restart.
+func (om *PersistentOM) Complete(name string, result any) (Operation, error) {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return Operation{}, fmt.Errorf("failed to encode result for operation %q: %w", name, err)
+	}
+	return om.finish(name, opstore.StatusDone, "", encoded)
+}
+
+// Fail marks the operation named name as done with opErr.
+func (om *PersistentOM) Fail(name string, opErr error) (Operation, error) {
+	return om.finish(name, opstore.StatusError, opErr.Error(), nil)
+}
+
+func (om *PersistentOM) finish(name string, status opstore.Status, errMsg string, result json.RawMessage) (Operation, error) {
+	storeOp, err := om.store.Get(context.Background(), name)
+	if err != nil {
+		return Operation{}, err
+	}
+	storeOp.Status = status
+	storeOp.Error = errMsg
+	storeOp.Result = result
+	storeOp.UpdatedAt = time.Now()
+	if err := om.store.Update(context.Background(), storeOp); err != nil {
+		return Operation{}, err
+	}
+	om.wg.Done()
+	return fromStoreOperation(storeOp), nil
+}
+
+func fromStoreOperation(op opstore.Operation) Operation {
+	return Operation{Name: op.ID, Done: op.Status != opstore.StatusRunning, Result: op.Result, Error: op.Error}
+}
+
+// Drain blocks until every operation created but not yet completed or
+// failed finishes, or ctx is done. It's used by Server.Shutdown (see
+// main.go) to avoid cutting off in-flight operations; it's named Drain,
+// rather than reusing a name like Wait that the per-operation polling path
+// may already use elsewhere in this package, to avoid any ambiguity.
+func (om *PersistentOM) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		om.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for in-flight operations to finish: %w", ctx.Err())
+	}
+}
+
+// Close stops the retention sweep and closes the underlying store. It does
+// not wait for in-flight operations; call Drain first if that's needed.
+func (om *PersistentOM) Close() error {
+	close(om.stopCleanup)
+	<-om.cleanupDone
+	return om.store.Close()
+}
+
+// HealthCheck reports whether the backing store is reachable, by round
+// tripping a List call against it. It's suitable for registration with
+// orchestrator/health.Registry.
+func (om *PersistentOM) HealthCheck(ctx context.Context) error {
+	_, err := om.store.List(ctx)
+	return err
+}
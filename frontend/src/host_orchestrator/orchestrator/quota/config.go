@@ -0,0 +1,118 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the quota subsystem's configuration. It's loaded from the JSON
+// or YAML file pointed to by ORCHESTRATOR_QUOTA_CONFIG and can be swapped
+// into a running Limiter at any time via Limiter.Reload, so it's always
+// safe to leave every field at its zero value (which disables that limit).
+type Config struct {
+	// MaxConcurrentCreates caps how many CVD create operations may be in
+	// flight across all users at once. Zero means unlimited.
+	MaxConcurrentCreates int `json:"max_concurrent_creates" yaml:"max_concurrent_creates"`
+
+	PerUser PerUserConfig `json:"per_user" yaml:"per_user"`
+
+	AndroidBuildRate AndroidBuildRateConfig `json:"android_build_rate" yaml:"android_build_rate"`
+}
+
+// PerUserConfig bounds what a single authenticated user may consume. Zero
+// values disable the corresponding check.
+type PerUserConfig struct {
+	// MaxConcurrentCVDs caps how many CVDs a single user may have running
+	// at once.
+	MaxConcurrentCVDs int `json:"max_concurrent_cvds" yaml:"max_concurrent_cvds"`
+	// MaxUploadBytes caps how many bytes of user artifacts a single user
+	// may upload within UploadWindow.
+	MaxUploadBytes int64 `json:"max_upload_bytes" yaml:"max_upload_bytes"`
+	// UploadWindow is the rolling window MaxUploadBytes applies over.
+	UploadWindow Duration `json:"upload_window" yaml:"upload_window"`
+}
+
+// AndroidBuildRateConfig configures the token bucket guarding outgoing
+// requests to the Android Build service.
+type AndroidBuildRateConfig struct {
+	// RequestsPerSecond is the bucket's steady-state refill rate. Zero
+	// disables the limit.
+	RequestsPerSecond float64 `json:"requests_per_second" yaml:"requests_per_second"`
+	// Burst is the bucket's capacity, i.e. how many requests may fire back
+	// to back before RequestsPerSecond throttling kicks in.
+	Burst int `json:"burst" yaml:"burst"`
+}
+
+// Duration wraps time.Duration so it can be parsed from a human-readable
+// string (e.g. "24h") in both JSON and YAML, rather than requiring raw
+// nanoseconds.
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	return d.parse(value.Value)
+}
+
+func (d *Duration) parse(s string) error {
+	if s == "" {
+		*d = 0
+		return nil
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadConfig reads and parses the quota config at path. The format is
+// chosen by file extension: ".json" for JSON, ".yaml"/".yml" for YAML.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read quota config %q: %w", path, err)
+	}
+	var cfg Config
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(data, &cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		return Config{}, fmt.Errorf("quota config %q: unsupported extension %q, want .json, .yaml or .yml", path, ext)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse quota config %q: %w", path, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,272 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package quota enforces global and per-user limits on CVD creation and
+// artifact uploads, and rate-limits outgoing requests to the Android Build
+// service. Configuration is loaded from the JSON/YAML file pointed to by
+// ORCHESTRATOR_QUOTA_CONFIG and can be swapped at runtime with Reload, so
+// the host orchestrator can pick up new limits on SIGHUP without a
+// restart.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Rejections is the subset of metrics.Metrics the quota package reports
+// through. It's an interface, rather than a direct dependency on the
+// metrics package, so Limiter stays easy to unit test.
+type Rejections interface {
+	// IncRejected records a single request rejected for reason, for user
+	// ("" if the caller isn't authenticated).
+	IncRejected(reason, user string)
+}
+
+// Limiter enforces the quota Config currently loaded. It's safe for
+// concurrent use, including while Reload swaps in a new Config.
+type Limiter struct {
+	store      Store
+	rejections Rejections
+
+	cfg atomic.Pointer[Config]
+
+	global         chan struct{} // capacity == MaxConcurrentCreates; nil means unlimited
+	androidBuild   *tokenBucket
+	retryAfterHint time.Duration
+}
+
+// NewLimiter returns a Limiter enforcing cfg, backed by store. rejections
+// may be nil, in which case rejected requests are simply not reported.
+func NewLimiter(cfg Config, store Store, rejections Rejections) *Limiter {
+	l := &Limiter{store: store, rejections: rejections, retryAfterHint: time.Second}
+	l.apply(cfg)
+	return l
+}
+
+func (l *Limiter) apply(cfg Config) {
+	var global chan struct{}
+	if cfg.MaxConcurrentCreates > 0 {
+		global = make(chan struct{}, cfg.MaxConcurrentCreates)
+	}
+	l.global = global
+	l.androidBuild = newTokenBucket(cfg.AndroidBuildRate.RequestsPerSecond, cfg.AndroidBuildRate.Burst)
+	l.cfg.Store(&cfg)
+}
+
+// Reload replaces the Limiter's Config. In-flight requests finish under the
+// limits they started under; only new requests observe cfg.
+func (l *Limiter) Reload(cfg Config) {
+	l.apply(cfg)
+}
+
+// ReloadFrom reads and parses the quota config at path and installs it,
+// following the same format rules as LoadConfig.
+func (l *Limiter) ReloadFrom(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	l.Reload(cfg)
+	return nil
+}
+
+func (l *Limiter) config() Config {
+	return *l.cfg.Load()
+}
+
+func (l *Limiter) reject(w http.ResponseWriter, reason, user string, retryAfter time.Duration) {
+	if l.rejections != nil {
+		l.rejections.IncRejected(reason, user)
+	}
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())))
+	http.Error(w, fmt.Sprintf("quota exceeded: %s", reason), http.StatusTooManyRequests)
+}
+
+// statusWriter wraps a ResponseWriter to capture the status code written,
+// so middleware can tell whether next actually succeeded after it returns.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// CreateMiddleware enforces the global concurrent-create limit and the
+// per-user concurrent-CVD quota around next, which must be the CVD create
+// route. identity, given a request, returns the caller's identity (e.g.
+// auth.FromContext); an empty string means unauthenticated, and only the
+// global limit applies.
+//
+// A global slot acquired here is only released by this middleware if next
+// rejects the request outright (a non-2xx status, meaning no CVD creation
+// was actually started). Otherwise the slot stays held after this handler
+// returns - CVD creation is long-running and polled to completion well
+// after the HTTP response - and it's the caller's job to free it with
+// ReleaseGlobal once that creation actually finishes; see
+// orchestrator.InstrumentedOM in main.go, which wires that up.
+func (l *Limiter) CreateMiddleware(identity func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := l.config()
+		user := identity(r)
+
+		acquiredGlobal := false
+		if l.global != nil {
+			select {
+			case l.global <- struct{}{}:
+				acquiredGlobal = true
+			default:
+				l.reject(w, "global concurrent create limit reached", user, l.retryAfterHint)
+				return
+			}
+		}
+		releaseGlobal := func() {
+			if acquiredGlobal {
+				l.ReleaseGlobal()
+			}
+		}
+
+		if user != "" && cfg.PerUser.MaxConcurrentCVDs > 0 {
+			n, err := l.store.ActiveCVDs(r.Context(), user)
+			if err != nil {
+				releaseGlobal()
+				http.Error(w, fmt.Sprintf("quota: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if n >= cfg.PerUser.MaxConcurrentCVDs {
+				releaseGlobal()
+				l.reject(w, "per-user concurrent CVD limit reached", user, l.retryAfterHint)
+				return
+			}
+		}
+		if user != "" {
+			if _, err := l.store.IncrCVDs(r.Context(), user); err != nil {
+				releaseGlobal()
+				http.Error(w, fmt.Sprintf("quota: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		if sw.status < 200 || sw.status >= 300 {
+			releaseGlobal()
+		}
+	})
+}
+
+// ReleaseCVD records that one of user's CVDs stopped, freeing a slot in
+// their concurrent-CVD quota. Callers should invoke it whenever a CVD
+// created through CreateMiddleware is torn down.
+func (l *Limiter) ReleaseCVD(ctx context.Context, user string) error {
+	return l.store.DecrCVDs(ctx, user)
+}
+
+// ReleaseGlobal frees one slot in the global concurrent-create limit. It's
+// the counterpart to the slot CreateMiddleware leaves held on a successful
+// create request; callers should invoke it once that CVD creation actually
+// finishes, not when the HTTP handler that started it returns.
+func (l *Limiter) ReleaseGlobal() {
+	if l.global == nil {
+		return
+	}
+	select {
+	case <-l.global:
+	default:
+	}
+}
+
+// countingReadCloser wraps an io.ReadCloser, counting the bytes read
+// through it.
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// UploadMiddleware enforces the per-user cumulative upload quota around
+// next, which must be the user artifact upload route. The quota store is
+// always updated with the number of bytes actually read from the request
+// body, not the declared Content-Length: that header is -1 for chunked or
+// otherwise unknown-length requests, and using it directly would both
+// under-count those uploads and poison the store's rolling window with
+// negative byte values. A non-negative Content-Length is still used for a
+// cheap pre-flight rejection, so a request that's already known to exceed
+// the quota doesn't get to read its body at all. onUpload, if non-nil, is
+// called with the actual byte count once next reports success; main.go
+// uses it to report UserArtifactUploadBytes.
+func (l *Limiter) UploadMiddleware(identity func(*http.Request) string, onUpload func(n int64), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := l.config()
+		user := identity(r)
+
+		if cfg.PerUser.MaxUploadBytes > 0 && r.ContentLength >= 0 {
+			window := time.Duration(cfg.PerUser.UploadWindow)
+			used, err := l.store.UploadedBytes(r.Context(), user, time.Now(), window)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("quota: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if used+r.ContentLength > cfg.PerUser.MaxUploadBytes {
+				l.reject(w, "per-user upload quota exceeded", user, window)
+				return
+			}
+		}
+
+		cr := &countingReadCloser{ReadCloser: r.Body}
+		r.Body = cr
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		if err := l.store.RecordUpload(r.Context(), user, cr.n, time.Now()); err != nil {
+			log.Printf("quota: failed to record upload of %d bytes for %q: %v", cr.n, user, err)
+		}
+		if sw.status >= 200 && sw.status < 300 && onUpload != nil {
+			onUpload(cr.n)
+		}
+	})
+}
+
+// AndroidBuildTransport wraps next so every outgoing request waits for a
+// token from the Android Build rate limiter before being sent, protecting
+// abURL from being overloaded. next defaults to http.DefaultTransport when
+// nil.
+func (l *Limiter) AndroidBuildTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if err := l.androidBuild.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
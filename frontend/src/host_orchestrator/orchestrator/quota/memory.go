@@ -0,0 +1,102 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type uploadEvent struct {
+	at    time.Time
+	bytes int64
+}
+
+type userState struct {
+	activeCVDs int
+	uploads    []uploadEvent
+}
+
+// MemoryStore is an in-process Store. It does not survive a restart, which
+// matches the orchestrator.NewMapOM default for operations.
+type MemoryStore struct {
+	mu    sync.Mutex
+	users map[string]*userState
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{users: make(map[string]*userState)}
+}
+
+func (s *MemoryStore) user(name string) *userState {
+	u, ok := s.users[name]
+	if !ok {
+		u = &userState{}
+		s.users[name] = u
+	}
+	return u
+}
+
+func (s *MemoryStore) IncrCVDs(_ context.Context, user string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.user(user)
+	u.activeCVDs++
+	return u.activeCVDs, nil
+}
+
+func (s *MemoryStore) DecrCVDs(_ context.Context, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.user(user)
+	if u.activeCVDs > 0 {
+		u.activeCVDs--
+	}
+	return nil
+}
+
+func (s *MemoryStore) ActiveCVDs(_ context.Context, user string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.user(user).activeCVDs, nil
+}
+
+func (s *MemoryStore) RecordUpload(_ context.Context, user string, bytes int64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.user(user)
+	u.uploads = append(u.uploads, uploadEvent{at: now, bytes: bytes})
+	return nil
+}
+
+func (s *MemoryStore) UploadedBytes(_ context.Context, user string, now time.Time, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.user(user)
+	cutoff := now.Add(-window)
+	var total int64
+	kept := u.uploads[:0]
+	for _, ev := range u.uploads {
+		if ev.at.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, ev)
+		total += ev.bytes
+	}
+	u.uploads = kept
+	return total, nil
+}
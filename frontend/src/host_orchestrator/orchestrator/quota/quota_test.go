@@ -0,0 +1,364 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreActiveCVDs(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	if n, err := s.IncrCVDs(ctx, "alice"); err != nil || n != 1 {
+		t.Fatalf("IncrCVDs() = (%d, %v), want (1, nil)", n, err)
+	}
+	if n, err := s.IncrCVDs(ctx, "alice"); err != nil || n != 2 {
+		t.Fatalf("IncrCVDs() = (%d, %v), want (2, nil)", n, err)
+	}
+	if err := s.DecrCVDs(ctx, "alice"); err != nil {
+		t.Fatalf("DecrCVDs() failed: %v", err)
+	}
+	if n, err := s.ActiveCVDs(ctx, "alice"); err != nil || n != 1 {
+		t.Fatalf("ActiveCVDs() = (%d, %v), want (1, nil)", n, err)
+	}
+	if n, err := s.ActiveCVDs(ctx, "bob"); err != nil || n != 0 {
+		t.Fatalf("ActiveCVDs(bob) = (%d, %v), want (0, nil)", n, err)
+	}
+}
+
+func TestMemoryStoreDecrCVDsFloorsAtZero(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	if err := s.DecrCVDs(ctx, "alice"); err != nil {
+		t.Fatalf("DecrCVDs() failed: %v", err)
+	}
+	if n, _ := s.ActiveCVDs(ctx, "alice"); n != 0 {
+		t.Errorf("ActiveCVDs() = %d, want 0", n)
+	}
+}
+
+func TestMemoryStoreUploadedBytesPrunesOldEvents(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Unix(1700000000, 0)
+
+	if err := s.RecordUpload(ctx, "alice", 100, now.Add(-2*time.Hour)); err != nil {
+		t.Fatalf("RecordUpload() failed: %v", err)
+	}
+	if err := s.RecordUpload(ctx, "alice", 50, now.Add(-time.Minute)); err != nil {
+		t.Fatalf("RecordUpload() failed: %v", err)
+	}
+
+	got, err := s.UploadedBytes(ctx, "alice", now, time.Hour)
+	if err != nil {
+		t.Fatalf("UploadedBytes() failed: %v", err)
+	}
+	if got != 50 {
+		t.Errorf("UploadedBytes() = %d, want 50 (the 2h-old event should be pruned)", got)
+	}
+}
+
+func TestTokenBucketAllow(t *testing.T) {
+	b := newTokenBucket(1000, 2) // high rate so refill never blocks this test
+	if !b.Allow() {
+		t.Fatal("Allow() = false on a fresh bucket, want true")
+	}
+	if !b.Allow() {
+		t.Fatal("Allow() = false on second call within burst, want true")
+	}
+}
+
+func TestTokenBucketExhausted(t *testing.T) {
+	b := newTokenBucket(0.001, 1) // effectively never refills within the test
+	if !b.Allow() {
+		t.Fatal("Allow() = false on first call, want true")
+	}
+	if b.Allow() {
+		t.Error("Allow() = true after the single token was consumed, want false")
+	}
+}
+
+func TestTokenBucketDisabledWhenRateIsZero(t *testing.T) {
+	b := newTokenBucket(0, 0)
+	for i := 0; i < 5; i++ {
+		if !b.Allow() {
+			t.Fatalf("Allow() = false on call %d of a disabled bucket, want true", i)
+		}
+	}
+}
+
+func constIdentity(user string) func(*http.Request) string {
+	return func(*http.Request) string { return user }
+}
+
+func TestCreateMiddlewareEnforcesGlobalLimit(t *testing.T) {
+	l := NewLimiter(Config{MaxConcurrentCreates: 1}, NewMemoryStore(), nil)
+	blockUntil := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-blockUntil
+		w.WriteHeader(http.StatusOK)
+	})
+	h := l.CreateMiddleware(constIdentity("alice"), slow)
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/cvds", nil))
+		close(done)
+	}()
+	// Give the first request a moment to acquire the global slot.
+	time.Sleep(20 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/cvds", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header missing on a rejected request")
+	}
+
+	close(blockUntil)
+	<-done
+}
+
+func TestCreateMiddlewareEnforcesPerUserLimit(t *testing.T) {
+	l := NewLimiter(Config{PerUser: PerUserConfig{MaxConcurrentCVDs: 1}}, NewMemoryStore(), nil)
+	h := l.CreateMiddleware(constIdentity("alice"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w1 := httptest.NewRecorder()
+	h.ServeHTTP(w1, httptest.NewRequest(http.MethodPost, "/cvds", nil))
+	if w1.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want %d", w1.Code, http.StatusOK)
+	}
+
+	w2 := httptest.NewRecorder()
+	h.ServeHTTP(w2, httptest.NewRequest(http.MethodPost, "/cvds", nil))
+	if w2.Code != http.StatusTooManyRequests {
+		t.Errorf("second request status = %d, want %d", w2.Code, http.StatusTooManyRequests)
+	}
+
+	// A different user is unaffected by alice's quota.
+	w3 := httptest.NewRecorder()
+	l.CreateMiddleware(constIdentity("bob"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(w3, httptest.NewRequest(http.MethodPost, "/cvds", nil))
+	if w3.Code != http.StatusOK {
+		t.Errorf("bob's request status = %d, want %d", w3.Code, http.StatusOK)
+	}
+}
+
+// drainAndOK reads and discards the request body (as a real upload handler
+// would) before reporting success, so the counting reader wrapped around
+// the body actually observes the bytes read.
+var drainAndOK = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestCreateMiddlewareHoldsGlobalSlotPastHandlerReturnOnSuccess(t *testing.T) {
+	l := NewLimiter(Config{MaxConcurrentCreates: 1}, NewMemoryStore(), nil)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	h := l.CreateMiddleware(constIdentity("alice"), ok)
+
+	w1 := httptest.NewRecorder()
+	h.ServeHTTP(w1, httptest.NewRequest(http.MethodPost, "/cvds", nil))
+	if w1.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want %d", w1.Code, http.StatusOK)
+	}
+
+	// The handler already returned, but the global slot should still be
+	// held: CreateMiddleware doesn't know the CVD it kicked off has
+	// actually finished coming up yet.
+	w2 := httptest.NewRecorder()
+	h.ServeHTTP(w2, httptest.NewRequest(http.MethodPost, "/cvds", nil))
+	if w2.Code != http.StatusTooManyRequests {
+		t.Errorf("second request status = %d, want %d (global slot should still be held)", w2.Code, http.StatusTooManyRequests)
+	}
+
+	l.ReleaseGlobal()
+	w3 := httptest.NewRecorder()
+	h.ServeHTTP(w3, httptest.NewRequest(http.MethodPost, "/cvds", nil))
+	if w3.Code != http.StatusOK {
+		t.Errorf("third request status = %d, want %d after ReleaseGlobal freed the slot", w3.Code, http.StatusOK)
+	}
+}
+
+func TestCreateMiddlewareReleasesGlobalSlotOnFailure(t *testing.T) {
+	l := NewLimiter(Config{MaxConcurrentCreates: 1}, NewMemoryStore(), nil)
+	fail := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) })
+	h := l.CreateMiddleware(constIdentity("alice"), fail)
+
+	w1 := httptest.NewRecorder()
+	h.ServeHTTP(w1, httptest.NewRequest(http.MethodPost, "/cvds", nil))
+	if w1.Code != http.StatusInternalServerError {
+		t.Fatalf("first request status = %d, want %d", w1.Code, http.StatusInternalServerError)
+	}
+
+	// next never actually started a CVD, so the slot must already be free.
+	w2 := httptest.NewRecorder()
+	h.ServeHTTP(w2, httptest.NewRequest(http.MethodPost, "/cvds", nil))
+	if w2.Code != http.StatusInternalServerError {
+		t.Errorf("second request status = %d, want %d (global slot should have been released)", w2.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestReleaseGlobalIsANoOpWhenUnlimited(t *testing.T) {
+	l := NewLimiter(Config{}, NewMemoryStore(), nil)
+	l.ReleaseGlobal() // must not panic when no global limit is configured
+}
+
+func TestUploadMiddlewareEnforcesByteQuota(t *testing.T) {
+	l := NewLimiter(Config{PerUser: PerUserConfig{MaxUploadBytes: 100, UploadWindow: Duration(time.Hour)}}, NewMemoryStore(), nil)
+
+	body := func(n int) *bytes.Reader { return bytes.NewReader(make([]byte, n)) }
+
+	w1 := httptest.NewRecorder()
+	req1 := httptest.NewRequest(http.MethodPost, "/uploads", body(60))
+	req1.ContentLength = 60
+	l.UploadMiddleware(constIdentity("alice"), nil, drainAndOK).ServeHTTP(w1, req1)
+	if w1.Code != http.StatusOK {
+		t.Fatalf("first upload status = %d, want %d", w1.Code, http.StatusOK)
+	}
+
+	w2 := httptest.NewRecorder()
+	req2 := httptest.NewRequest(http.MethodPost, "/uploads", body(60))
+	req2.ContentLength = 60
+	l.UploadMiddleware(constIdentity("alice"), nil, drainAndOK).ServeHTTP(w2, req2)
+	if w2.Code != http.StatusTooManyRequests {
+		t.Errorf("second upload status = %d, want %d (60+60 > 100 byte quota)", w2.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestUploadMiddlewareRecordsActualBytesForUnknownLength(t *testing.T) {
+	l := NewLimiter(Config{PerUser: PerUserConfig{MaxUploadBytes: 100, UploadWindow: Duration(time.Hour)}}, NewMemoryStore(), nil)
+
+	// A chunked or otherwise unknown-length request reports ContentLength
+	// -1; the pre-flight check must not reject it outright (it has no
+	// length to check against), and the actual bytes read must still be
+	// recorded so later uploads see the right running total.
+	req := httptest.NewRequest(http.MethodPost, "/uploads", strings.NewReader(strings.Repeat("a", 60)))
+	req.ContentLength = -1
+
+	var reported int64
+	w := httptest.NewRecorder()
+	l.UploadMiddleware(constIdentity("alice"), func(n int64) { reported = n }, drainAndOK).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if reported != 60 {
+		t.Errorf("onUpload reported %d bytes, want 60 (the actual body size)", reported)
+	}
+
+	used, err := l.store.UploadedBytes(context.Background(), "alice", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("UploadedBytes() failed: %v", err)
+	}
+	if used != 60 {
+		t.Errorf("store recorded %d bytes, want 60", used)
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+	const data = `{
+		"max_concurrent_creates": 5,
+		"per_user": {"max_concurrent_cvds": 2, "max_upload_bytes": 1000, "upload_window": "24h"},
+		"android_build_rate": {"requests_per_second": 2.5, "burst": 4}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if cfg.MaxConcurrentCreates != 5 {
+		t.Errorf("MaxConcurrentCreates = %d, want 5", cfg.MaxConcurrentCreates)
+	}
+	if time.Duration(cfg.PerUser.UploadWindow) != 24*time.Hour {
+		t.Errorf("UploadWindow = %s, want 24h", time.Duration(cfg.PerUser.UploadWindow))
+	}
+	if cfg.AndroidBuildRate.RequestsPerSecond != 2.5 {
+		t.Errorf("RequestsPerSecond = %v, want 2.5", cfg.AndroidBuildRate.RequestsPerSecond)
+	}
+}
+
+func TestLoadConfigYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.yaml")
+	const data = "max_concurrent_creates: 3\nper_user:\n  max_concurrent_cvds: 1\n  upload_window: 1h\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if cfg.MaxConcurrentCreates != 3 {
+		t.Errorf("MaxConcurrentCreates = %d, want 3", cfg.MaxConcurrentCreates)
+	}
+	if time.Duration(cfg.PerUser.UploadWindow) != time.Hour {
+		t.Errorf("UploadWindow = %s, want 1h", time.Duration(cfg.PerUser.UploadWindow))
+	}
+}
+
+func TestReload(t *testing.T) {
+	l := NewLimiter(Config{MaxConcurrentCreates: 1}, NewMemoryStore(), nil)
+	l.Reload(Config{MaxConcurrentCreates: 2})
+
+	blockUntil := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-blockUntil
+		w.WriteHeader(http.StatusOK)
+	})
+	h := l.CreateMiddleware(constIdentity("alice"), slow)
+
+	done1 := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/cvds", nil))
+		close(done1)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// A second concurrent request should now succeed, since Reload raised
+	// the limit to 2 before either request started.
+	w := httptest.NewRecorder()
+	done2 := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/cvds", nil))
+		close(done2)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(blockUntil)
+	<-done1
+	<-done2
+
+	if w.Code != http.StatusOK {
+		t.Errorf("second concurrent request status = %d, want %d after Reload raised the limit to 2", w.Code, http.StatusOK)
+	}
+}
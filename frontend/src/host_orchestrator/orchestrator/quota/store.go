@@ -0,0 +1,42 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"context"
+	"time"
+)
+
+// Store persists per-user quota state: how many CVDs a user currently owns
+// and how many artifact upload bytes they've recorded recently. MemoryStore
+// is the only implementation today; a persistent backend can be added
+// later following the same pattern as opstore.Store.
+type Store interface {
+	// IncrCVDs records that user started one more CVD and returns their new
+	// active count.
+	IncrCVDs(ctx context.Context, user string) (int, error)
+	// DecrCVDs records that one of user's CVDs stopped. It's a no-op if
+	// user has no active CVDs on record.
+	DecrCVDs(ctx context.Context, user string) error
+	// ActiveCVDs returns how many CVDs user currently owns.
+	ActiveCVDs(ctx context.Context, user string) (int, error)
+
+	// RecordUpload records that user uploaded bytes worth of artifacts at
+	// now.
+	RecordUpload(ctx context.Context, user string, bytes int64, now time.Time) error
+	// UploadedBytes returns the cumulative bytes user has uploaded within
+	// window of now.
+	UploadedBytes(ctx context.Context, user string, now time.Time, window time.Duration) (int64, error)
+}
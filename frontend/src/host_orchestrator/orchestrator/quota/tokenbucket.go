@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a classic token bucket rate limiter: it refills at a fixed
+// rate up to a capacity, and each request consumes one token. A zero-value
+// tokenBucket (rate 0) never throttles, so it's safe to use before any
+// quota config has been loaded.
+type tokenBucket struct {
+	mu sync.Mutex
+
+	ratePerSecond float64
+	capacity      float64
+
+	tokens     float64
+	lastRefill time.Time
+}
+
+// newTokenBucket returns a tokenBucket that allows burst requests up to
+// capacity and refills at ratePerSecond tokens/second. ratePerSecond <= 0
+// disables the limit.
+func newTokenBucket(ratePerSecond float64, capacity int) *tokenBucket {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &tokenBucket{
+		ratePerSecond: ratePerSecond,
+		capacity:      float64(capacity),
+		tokens:        float64(capacity),
+		lastRefill:    time.Now(),
+	}
+}
+
+func (b *tokenBucket) refillLocked(now time.Time) {
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = min(b.capacity, b.tokens+elapsed*b.ratePerSecond)
+	b.lastRefill = now
+}
+
+// Allow consumes a token and reports whether one was available. It never
+// blocks.
+func (b *tokenBucket) Allow() bool {
+	if b == nil || b.ratePerSecond <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillLocked(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	if b == nil || b.ratePerSecond <= 0 {
+		return nil
+	}
+	for {
+		b.mu.Lock()
+		b.refillLocked(time.Now())
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		missing := 1 - b.tokens
+		wait := time.Duration(missing/b.ratePerSecond*1000) * time.Millisecond
+		b.mu.Unlock()
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func min(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,39 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/android-cuttlefish/frontend/src/host_orchestrator/orchestrator/health"
+)
+
+// NewUserArtifactsHealthCheck returns a health.Checker reporting whether
+// the UserArtifactsManager built from opts can actually write to its root
+// directory, so host_orchestrator/readyz surfaces disk pressure or
+// permission problems under the upload path before a user hits them.
+func NewUserArtifactsHealthCheck(opts UserArtifactsManagerOpts) health.CheckerFunc {
+	return func(context.Context) error {
+		f, err := os.CreateTemp(opts.RootDir, ".readyz-*")
+		if err != nil {
+			return fmt.Errorf("%s: %w", opts.RootDir, err)
+		}
+		name := f.Name()
+		f.Close()
+		return os.Remove(name)
+	}
+}